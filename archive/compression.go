@@ -0,0 +1,144 @@
+// Package archive provides the compression formats and the age encryption, to X25519 recipients or with a
+// passphrase, applied to backup archives.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression identifies the compression format applied to a tar archive.
+type Compression string
+
+const (
+	// None leaves the tar archive uncompressed.
+	None Compression = "none"
+
+	// Gzip compresses the tar archive with gzip.
+	Gzip Compression = "gzip"
+
+	// Zstd compresses the tar archive with Zstandard.
+	Zstd Compression = "zstd"
+
+	// Xz compresses the tar archive with xz.
+	Xz Compression = "xz"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// magicLen is the number of leading bytes needed to detect every supported compression.
+const magicLen = 6
+
+// ParseCompression returns the Compression named by s. An empty string is treated as None.
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case "":
+		return None, nil
+	case None, Gzip, Zstd, Xz:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q, expected one of gzip, zstd, xz or none", s)
+	}
+}
+
+// Extension returns the suffix appended to the ".tar" extension of archives compressed with c.
+func (c Compression) Extension() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	case Xz:
+		return ".xz"
+	default:
+		return ""
+	}
+}
+
+// NewWriter returns a writer that compresses the data written to it with c before writing it to w.
+// Closing the returned writer flushes the compressor but does not close w.
+func NewWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case None, "":
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	case Xz:
+		return xz.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", c)
+	}
+}
+
+// Detect returns the compression of the data in r by looking at its magic bytes, without consuming them.
+func Detect(r *bufio.Reader) (Compression, error) {
+	head, err := r.Peek(magicLen)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read archive header: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return Gzip, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		return Zstd, nil
+	case bytes.HasPrefix(head, xzMagic):
+		return Xz, nil
+	default:
+		return None, nil
+	}
+}
+
+// NewReader detects the compression of the data in r from its magic bytes and returns a reader producing the
+// decompressed tar stream along with the detected compression.
+func NewReader(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	c, err := Detect(br)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch c {
+	case Gzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		return zr, c, nil
+	case Zstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		return zr.IOReadCloser(), c, nil
+	case Xz:
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open xz stream: %w", err)
+		}
+		return io.NopCloser(xr), c, nil
+	default:
+		return io.NopCloser(br), c, nil
+	}
+}
+
+// nopWriteCloser wraps a writer with a Close method that does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing and always returns nil.
+func (nopWriteCloser) Close() error {
+	return nil
+}
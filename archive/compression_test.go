@@ -0,0 +1,99 @@
+package archive_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// TestParseCompression verifies that compression names are parsed and unsupported ones rejected.
+func TestParseCompression(t *testing.T) {
+	tests := map[string]archive.Compression{
+		"":     archive.None,
+		"none": archive.None,
+		"gzip": archive.Gzip,
+		"zstd": archive.Zstd,
+		"xz":   archive.Xz,
+	}
+	for in, expected := range tests {
+		c, err := archive.ParseCompression(in)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %s", in, err)
+		}
+		if c != expected {
+			t.Errorf("expected %s for %q, got %s", expected, in, c)
+		}
+	}
+
+	if _, err := archive.ParseCompression("bzip2"); err == nil {
+		t.Errorf("expected error for unsupported compression, got nil")
+	}
+}
+
+// TestExtension verifies the archive name extension of every compression.
+func TestExtension(t *testing.T) {
+	tests := map[archive.Compression]string{
+		archive.None: "",
+		archive.Gzip: ".gz",
+		archive.Zstd: ".zst",
+		archive.Xz:   ".xz",
+	}
+	for c, expected := range tests {
+		if ext := c.Extension(); ext != expected {
+			t.Errorf("expected extension %q for %s, got %q", expected, c, ext)
+		}
+	}
+}
+
+// TestRoundTrip verifies that data compressed with every compression is detected and decompressed back.
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("aerovault "), 1024)
+
+	for _, c := range []archive.Compression{archive.None, archive.Gzip, archive.Zstd, archive.Xz} {
+		var buf bytes.Buffer
+		w, err := archive.NewWriter(&buf, c)
+		if err != nil {
+			t.Fatalf("%s: failed to create writer: %s", c, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("%s: failed to write: %s", c, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: failed to close writer: %s", c, err)
+		}
+
+		r, detected, err := archive.NewReader(&buf)
+		if err != nil {
+			t.Fatalf("%s: failed to create reader: %s", c, err)
+		}
+		if detected != c {
+			t.Errorf("expected detected compression %s, got %s", c, detected)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: failed to read: %s", c, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: failed to close reader: %s", c, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("%s: decompressed data does not match", c)
+		}
+	}
+}
+
+// TestNewReader_shortInput verifies that inputs shorter than the longest magic are read as uncompressed.
+func TestNewReader_shortInput(t *testing.T) {
+	r, c, err := archive.NewReader(bytes.NewReader([]byte("ab")))
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if c != archive.None {
+		t.Errorf("expected no compression, got %s", c)
+	}
+	if out, _ := io.ReadAll(r); string(out) != "ab" {
+		t.Errorf("expected 'ab', got %q", out)
+	}
+}
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// EncryptedExtension is the suffix appended to the name of encrypted archives.
+const EncryptedExtension = ".age"
+
+const (
+	// MethodX25519 encrypts archives to age X25519 recipients.
+	MethodX25519 = "age-x25519"
+
+	// MethodScrypt encrypts archives with a key derived from a passphrase with scrypt.
+	MethodScrypt = "age-scrypt"
+)
+
+// ageMagic starts the header of every binary age file.
+var ageMagic = []byte("age-encryption.org/")
+
+// ErrMissingIdentity is returned when an encrypted archive is read without any identity to decrypt it.
+var ErrMissingIdentity = errors.New("archive is encrypted, an identity or passphrase is required to decrypt it")
+
+// Encryption configures the age encryption applied to archives, after compression.
+type Encryption struct {
+	method     string
+	recipients []age.Recipient
+	keys       []string
+}
+
+// NewRecipientEncryption returns an Encryption to the given age X25519 recipients. Each recipient is either a public
+// key starting with "age1" or the path of a file listing one public key per line.
+func NewRecipientEncryption(recipients []string) (*Encryption, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipients given")
+	}
+
+	e := &Encryption{method: MethodX25519}
+	for _, r := range recipients {
+		var parsed []age.Recipient
+		if strings.HasPrefix(r, "age1") {
+			recipient, err := age.ParseX25519Recipient(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %q: %w", r, err)
+			}
+			parsed = []age.Recipient{recipient}
+		} else {
+			f, err := os.Open(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open recipients file: %w", err)
+			}
+			parsed, err = age.ParseRecipients(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse recipients file %s: %w", r, err)
+			}
+		}
+
+		for _, recipient := range parsed {
+			x, ok := recipient.(*age.X25519Recipient)
+			if !ok {
+				return nil, fmt.Errorf("unsupported recipient type %T in %s, only X25519 keys are supported", recipient, r)
+			}
+			e.recipients = append(e.recipients, x)
+			e.keys = append(e.keys, x.String())
+		}
+	}
+	return e, nil
+}
+
+// NewPassphraseEncryption returns an Encryption with a key derived from the passphrase with scrypt.
+func NewPassphraseEncryption(passphrase string) (*Encryption, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Encryption{method: MethodScrypt, recipients: []age.Recipient{recipient}}, nil
+}
+
+// Method returns the encryption method, MethodX25519 or MethodScrypt.
+func (e *Encryption) Method() string {
+	return e.method
+}
+
+// Recipients returns the public keys archives are encrypted to. It is empty for passphrase encryption.
+func (e *Encryption) Recipients() []string {
+	return e.keys
+}
+
+// NewWriter returns a writer that encrypts the data written to it before writing it to w.
+// Closing the returned writer flushes the last encrypted chunk but does not close w.
+func (e *Encryption) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(w, e.recipients...)
+}
+
+// ParseIdentityFile reads the age identities listed in the named file, one "AGE-SECRET-KEY-1" key per line.
+func ParseIdentityFile(name string) ([]age.Identity, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", name, err)
+	}
+	return identities, nil
+}
+
+// PassphraseIdentity returns the identity decrypting archives encrypted with the given passphrase.
+func PassphraseIdentity(passphrase string) (age.Identity, error) {
+	return age.NewScryptIdentity(passphrase)
+}
+
+// IsEncrypted reports whether the data in r is an age encrypted file, without consuming it.
+func IsEncrypted(r *bufio.Reader) (bool, error) {
+	head, err := r.Peek(len(ageMagic))
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	return bytes.Equal(head, ageMagic), nil
+}
+
+// Decrypt returns a reader producing the decrypted content of r with the given identities, and reports whether r was
+// encrypted. Data that is not encrypted is returned as is. It returns ErrMissingIdentity for encrypted data when no
+// identity is given.
+func Decrypt(r io.Reader, identities []age.Identity) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	encrypted, err := IsEncrypted(br)
+	if err != nil || !encrypted {
+		return br, false, err
+	}
+	if len(identities) == 0 {
+		return nil, true, ErrMissingIdentity
+	}
+
+	dr, err := age.Decrypt(br, identities...)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decrypt archive: %w", err)
+	}
+	return dr, true, nil
+}
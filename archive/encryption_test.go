@@ -0,0 +1,148 @@
+package archive_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// encrypt returns data encrypted with e.
+func encrypt(t *testing.T, e *archive.Encryption, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := e.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("failed to create encrypting writer: %s", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("failed to encrypt: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close encrypting writer: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// decrypt returns the decrypted content of data, failing the test if it is not encrypted.
+func decrypt(t *testing.T, data []byte, identities []age.Identity) []byte {
+	t.Helper()
+	r, encrypted, err := archive.Decrypt(bytes.NewReader(data), identities)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !encrypted {
+		t.Fatal("expected data to be detected as encrypted")
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %s", err)
+	}
+	return plain
+}
+
+// TestRecipientEncryption verifies that archives encrypted to recipients, given as keys or files, are decrypted by any
+// of their identities.
+func TestRecipientEncryption(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+
+	dir := t.TempDir()
+	recipientsFile := filepath.Join(dir, "recipients.txt")
+	if err := os.WriteFile(recipientsFile, []byte("# backup operators\n"+other.Recipient().String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "identity.txt")
+	if err := os.WriteFile(identityFile, []byte(other.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := archive.NewRecipientEncryption([]string{identity.Recipient().String(), recipientsFile})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if e.Method() != archive.MethodX25519 || len(e.Recipients()) != 2 {
+		t.Errorf("expected two X25519 recipients, got %s %v", e.Method(), e.Recipients())
+	}
+
+	data := []byte("archive")
+	encrypted := encrypt(t, e, data)
+	if bytes.Contains(encrypted, data) {
+		t.Error("expected data to be encrypted")
+	}
+
+	if plain := decrypt(t, encrypted, []age.Identity{identity}); !bytes.Equal(plain, data) {
+		t.Errorf("expected %q, got %q", data, plain)
+	}
+	identities, err := archive.ParseIdentityFile(identityFile)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if plain := decrypt(t, encrypted, identities); !bytes.Equal(plain, data) {
+		t.Errorf("expected %q, got %q", data, plain)
+	}
+}
+
+// TestPassphraseEncryption verifies that archives encrypted with a passphrase are only decrypted with the same
+// passphrase.
+func TestPassphraseEncryption(t *testing.T) {
+	e, err := archive.NewPassphraseEncryption("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if e.Method() != archive.MethodScrypt {
+		t.Errorf("expected method %s, got %s", archive.MethodScrypt, e.Method())
+	}
+
+	data := []byte("archive")
+	encrypted := encrypt(t, e, data)
+
+	identity, _ := archive.PassphraseIdentity("correct horse battery staple")
+	if plain := decrypt(t, encrypted, []age.Identity{identity}); !bytes.Equal(plain, data) {
+		t.Errorf("expected %q, got %q", data, plain)
+	}
+
+	wrong, _ := archive.PassphraseIdentity("wrong")
+	if _, _, err := archive.Decrypt(bytes.NewReader(encrypted), []age.Identity{wrong}); err == nil {
+		t.Error("expected error for wrong passphrase, got nil")
+	}
+}
+
+// TestDecrypt_plain verifies that unencrypted data is passed through unchanged.
+func TestDecrypt_plain(t *testing.T) {
+	r, encrypted, err := archive.Decrypt(bytes.NewReader([]byte("archive")), nil)
+	if err != nil || encrypted {
+		t.Fatalf("expected plain data to pass through, got encrypted=%t err=%v", encrypted, err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "archive" {
+		t.Errorf("expected 'archive', got %q", data)
+	}
+}
+
+// TestDecrypt_missingIdentity verifies that decrypting without any identity returns ErrMissingIdentity.
+func TestDecrypt_missingIdentity(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	e, _ := archive.NewRecipientEncryption([]string{identity.Recipient().String()})
+
+	_, _, err := archive.Decrypt(bytes.NewReader(encrypt(t, e, []byte("archive"))), nil)
+	if !errors.Is(err, archive.ErrMissingIdentity) {
+		t.Errorf("expected ErrMissingIdentity, got %v", err)
+	}
+}
+
+// TestNewRecipientEncryption_errors verifies that missing or invalid recipients and empty passphrases are rejected.
+func TestNewRecipientEncryption_errors(t *testing.T) {
+	for _, recipients := range [][]string{nil, {"age1invalid"}, {filepath.Join(t.TempDir(), "missing.txt")}} {
+		if _, err := archive.NewRecipientEncryption(recipients); err == nil {
+			t.Errorf("expected error for %v, got nil", recipients)
+		}
+	}
+	if _, err := archive.NewPassphraseEncryption(""); err == nil {
+		t.Error("expected error for empty passphrase, got nil")
+	}
+}
@@ -0,0 +1,119 @@
+// Package catalog enumerates the backup archives held by a storage backend.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// Backup describes a backup archive found in a storage backend. Container, SHA256 and FileCount are only known for
+// archives stored with a manifest, whose name is then given by Manifest.
+type Backup struct {
+	Name        string              `json:"name"`
+	Location    string              `json:"location"`
+	Volume      string              `json:"volume"`
+	Container   string              `json:"container,omitempty"`
+	Time        time.Time           `json:"time"`
+	Size        int64               `json:"size"`
+	Compression archive.Compression `json:"compression"`
+	Encrypted   bool                `json:"encrypted"`
+	SHA256      string              `json:"sha256,omitempty"`
+	FileCount   int64               `json:"file_count,omitempty"`
+	Manifest    string              `json:"manifest,omitempty"`
+}
+
+// Filter selects the backups returned by List. Empty fields match every backup.
+type Filter struct {
+	Volume    string
+	Container string
+}
+
+// match reports whether the backup is selected by the filter.
+func (f Filter) match(b Backup) bool {
+	return (f.Volume == "" || b.Volume == f.Volume) && (f.Container == "" || b.Container == f.Container)
+}
+
+// List returns the backups stored in b that match the filter, sorted by volume and then by time. Objects whose name
+// does not follow the archive naming scheme are ignored. The manifests stored alongside the archives are read to
+// complete the details given by the archive names; a manifest that cannot be read is ignored.
+func List(ctx context.Context, b storage.Backend, f Filter) ([]Backup, error) {
+	prefix := ""
+	if f.Volume != "" {
+		prefix = f.Volume + "-"
+	}
+	objects, err := b.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := map[string]bool{}
+	for _, obj := range objects {
+		if dockerbackup.IsManifestName(obj.Name) {
+			manifests[obj.Name] = true
+		}
+	}
+
+	backups := []Backup{}
+	for _, obj := range objects {
+		if dockerbackup.IsManifestName(obj.Name) {
+			continue
+		}
+		an, err := dockerbackup.ParseArchiveName(obj.Name)
+		if err != nil {
+			continue
+		}
+		backup := Backup{
+			Name:        obj.Name,
+			Location:    b.Location(obj.Name),
+			Volume:      an.Volume,
+			Time:        an.Time,
+			Size:        obj.Size,
+			Compression: an.Compression,
+			Encrypted:   an.Encrypted,
+		}
+		if name := dockerbackup.ManifestName(obj.Name); manifests[name] {
+			if m, err := ReadManifest(ctx, b, obj.Name); err == nil {
+				backup.Manifest = name
+				backup.SHA256 = m.SHA256
+				backup.FileCount = m.FileCount
+				if m.Container != nil {
+					backup.Container = m.Container.Name
+				}
+			}
+		}
+		if f.match(backup) {
+			backups = append(backups, backup)
+		}
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].Volume != backups[j].Volume {
+			return backups[i].Volume < backups[j].Volume
+		}
+		return backups[i].Time.Before(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// ReadManifest reads the manifest stored in b alongside the named archive. It returns an error wrapping
+// storage.ErrNotFound if the archive has no manifest.
+func ReadManifest(ctx context.Context, b storage.Backend, archiveName string) (*dockerbackup.Manifest, error) {
+	name := dockerbackup.ManifestName(archiveName)
+	rc, err := b.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	m, err := dockerbackup.ReadManifest(rc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,148 @@
+package catalog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// newBackend returns a local backend holding the named objects, each with its name as content.
+func newBackend(t *testing.T, names ...string) storage.Backend {
+	t.Helper()
+	b, err := storage.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := b.Put(context.Background(), name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+// putManifest stores the manifest in b alongside its archive.
+func putManifest(t *testing.T, b storage.Backend, m dockerbackup.Manifest) {
+	t.Helper()
+	m.ManifestVersion = dockerbackup.ManifestVersion
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(context.Background(), dockerbackup.ManifestName(m.Archive), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestList verifies that archives are listed in name order with the details parsed from their names, skipping other
+// objects.
+func TestList(t *testing.T) {
+	b := newBackend(t, "data-1609459300.tar.gz.age", "data-1609459200.tar", "db-1609459200.tar.zst", "data-db-1609459200.tar", "notes.txt")
+
+	backups, err := catalog.List(context.Background(), b, catalog.Filter{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var names []string
+	for _, backup := range backups {
+		names = append(names, backup.Name)
+	}
+	expected := "data-1609459200.tar, data-1609459300.tar.gz.age, data-db-1609459200.tar, db-1609459200.tar.zst"
+	if got := strings.Join(names, ", "); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	gz := backups[1]
+	if gz.Volume != "data" || gz.Time.Unix() != 1609459300 || gz.Compression != archive.Gzip || !gz.Encrypted {
+		t.Errorf("unexpected backup %+v", gz)
+	}
+	if gz.Size != int64(len(gz.Name)) || gz.Location != b.Location(gz.Name) {
+		t.Errorf("expected size and location from the backend, got %+v", gz)
+	}
+}
+
+// TestList_filter verifies that backups are filtered by volume, and by container only when a manifest records it.
+func TestList_filter(t *testing.T) {
+	b := newBackend(t, "data-1609459200.tar", "data-db-1609459200.tar", "db-1609459200.tar")
+
+	backups, err := catalog.List(context.Background(), b, catalog.Filter{Volume: "data"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(backups) != 1 || backups[0].Volume != "data" {
+		t.Errorf("expected only the backup of volume data, got %+v", backups)
+	}
+
+	backups, err = catalog.List(context.Background(), b, catalog.Filter{Container: "web"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("expected no backups without a recorded container, got %+v", backups)
+	}
+}
+
+// TestList_manifest verifies that backups are listed with the details of their manifest, and filtered by its container.
+func TestList_manifest(t *testing.T) {
+	b := newBackend(t, "data-1609459200.tar", "data-1609459300.tar", "cache-1609459200.tar")
+	putManifest(t, b, dockerbackup.Manifest{
+		Archive:   "data-1609459300.tar",
+		Container: &dockerbackup.ManifestContainer{Name: "web"},
+		FileCount: 12,
+		SHA256:    "0eb3e36b",
+	})
+	// A manifest whose archive is gone is not listed.
+	putManifest(t, b, dockerbackup.Manifest{Archive: "data-1609459100.tar"})
+
+	backups, err := catalog.List(context.Background(), b, catalog.Filter{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("expected 3 backups, got %+v", backups)
+	}
+	if backups[1].Manifest != "" || backups[1].SHA256 != "" {
+		t.Errorf("expected no manifest details for %s, got %+v", backups[1].Name, backups[1])
+	}
+	withManifest := backups[2]
+	if withManifest.Container != "web" || withManifest.SHA256 != "0eb3e36b" || withManifest.FileCount != 12 {
+		t.Errorf("expected details from the manifest, got %+v", withManifest)
+	}
+	if withManifest.Manifest != "data-1609459300.tar.manifest.json" {
+		t.Errorf("expected manifest name, got %s", withManifest.Manifest)
+	}
+
+	backups, err = catalog.List(context.Background(), b, catalog.Filter{Container: "web"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(backups) != 1 || backups[0].Name != "data-1609459300.tar" {
+		t.Errorf("expected only the backup taken through web, got %+v", backups)
+	}
+}
+
+// TestReadManifest verifies that the manifest of an archive is read, and that a missing one is reported as ErrNotFound.
+func TestReadManifest(t *testing.T) {
+	b := newBackend(t, "data-1609459200.tar")
+	if _, err := catalog.ReadManifest(context.Background(), b, "data-1609459200.tar"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	putManifest(t, b, dockerbackup.Manifest{Archive: "data-1609459200.tar", Compression: archive.Gzip})
+	m, err := catalog.ReadManifest(context.Background(), b, "data-1609459200.tar")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if m.Archive != "data-1609459200.tar" || m.Compression != archive.Gzip {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+}
@@ -0,0 +1,226 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// Policy is a grandfather-father-son retention policy. Each rule keeps the newest backup of that many distinct
+// periods, in addition to the backups kept by the other rules. Rules set to zero keep nothing.
+type Policy struct {
+	KeepLast    int `json:"keep_last,omitempty"`
+	KeepDaily   int `json:"keep_daily,omitempty"`
+	KeepWeekly  int `json:"keep_weekly,omitempty"`
+	KeepMonthly int `json:"keep_monthly,omitempty"`
+	KeepYearly  int `json:"keep_yearly,omitempty"`
+}
+
+// IsZero reports whether the policy has no rules, in which case it would retain nothing.
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+// ParsePolicy parses a retention policy written as comma separated rules, such as "last=3,daily=7,weekly=4".
+// The rules are last, daily, weekly, monthly and yearly, optionally prefixed with "keep-" as the prune flags are.
+func ParsePolicy(s string) (Policy, error) {
+	var p Policy
+	rules := map[string]*int{
+		"last":    &p.KeepLast,
+		"daily":   &p.KeepDaily,
+		"weekly":  &p.KeepWeekly,
+		"monthly": &p.KeepMonthly,
+		"yearly":  &p.KeepYearly,
+	}
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("invalid retention rule %q, expected name=count", field)
+		}
+		count, ok := rules[strings.TrimPrefix(strings.TrimSpace(name), "keep-")]
+		if !ok {
+			return Policy{}, fmt.Errorf("unknown retention rule %q, expected last, daily, weekly, monthly or yearly", name)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid count in retention rule %q", field)
+		}
+		*count = n
+	}
+	return p, p.validate()
+}
+
+// validate checks that the policy keeps at least one backup and that no rule is negative.
+func (p Policy) validate() error {
+	if p.IsZero() {
+		return errors.New("retention policy keeps no backups, set at least one keep rule")
+	}
+	if p.KeepLast < 0 || p.KeepDaily < 0 || p.KeepWeekly < 0 || p.KeepMonthly < 0 || p.KeepYearly < 0 {
+		return errors.New("retention policy rules must not be negative")
+	}
+	return nil
+}
+
+// retentionRule keeps the newest backup of count distinct periods, the period of a backup being given by key.
+type retentionRule struct {
+	name  string
+	count int
+	key   func(t time.Time) string
+}
+
+// rules returns the period rules of the policy, from the shortest to the longest period.
+func (p Policy) rules() []retentionRule {
+	return []retentionRule{
+		{name: "daily", count: p.KeepDaily, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{name: "weekly", count: p.KeepWeekly, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{name: "monthly", count: p.KeepMonthly, key: func(t time.Time) string { return t.Format("2006-01") }},
+		{name: "yearly", count: p.KeepYearly, key: func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// PruneDecision records whether a backup is kept by the retention policy, the rules that retained it, and the error
+// of its deletion if it failed.
+type PruneDecision struct {
+	Backup  Backup
+	Keep    bool
+	Reasons []string
+	Err     error
+}
+
+// MarshalJSON encodes the decision, replacing the error with its message.
+func (d PruneDecision) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Backup  Backup   `json:"backup"`
+		Keep    bool     `json:"keep"`
+		Reasons []string `json:"reasons,omitempty"`
+		Error   string   `json:"error,omitempty"`
+	}{Backup: d.Backup, Keep: d.Keep, Reasons: d.Reasons}
+	if d.Err != nil {
+		out.Error = d.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// PruneReport lists the retention decision taken for every backup considered by Prune.
+type PruneReport struct {
+	Policy    Policy          `json:"policy"`
+	DryRun    bool            `json:"dry_run"`
+	Decisions []PruneDecision `json:"decisions"`
+}
+
+// Deleted returns the decisions of the backups that were, or in a dry run would be, deleted.
+func (r *PruneReport) Deleted() []PruneDecision {
+	var deleted []PruneDecision
+	for _, d := range r.Decisions {
+		if !d.Keep {
+			deleted = append(deleted, d)
+		}
+	}
+	return deleted
+}
+
+// Err returns an error joining the failed deletions, or nil if every deletion succeeded.
+func (r *PruneReport) Err() error {
+	var errs []error
+	for _, d := range r.Decisions {
+		if d.Err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", d.Backup.Name, d.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prune applies the retention policy to the backups of b that match the filter, separately for every volume, and
+// deletes the backups that no rule retains, along with their manifests. With dryRun, the decisions are reported
+// without deleting anything.
+// A failed deletion is recorded in the report and does not stop the pruning of the remaining backups.
+func Prune(ctx context.Context, b storage.Backend, policy Policy, f Filter, dryRun bool) (*PruneReport, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	backups, err := List(ctx, b, f)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{Policy: policy, DryRun: dryRun, Decisions: applyPolicy(policy, backups)}
+	if dryRun {
+		return report, nil
+	}
+	for i := range report.Decisions {
+		d := &report.Decisions[i]
+		if !d.Keep {
+			d.Err = deleteBackup(ctx, b, d.Backup)
+		}
+	}
+	return report, nil
+}
+
+// deleteBackup deletes the archive of the backup and then its manifest. A failure leaves at most an orphaned
+// manifest behind, which List ignores.
+func deleteBackup(ctx context.Context, b storage.Backend, backup Backup) error {
+	if err := b.Delete(ctx, backup.Name); err != nil {
+		return err
+	}
+	if backup.Manifest == "" {
+		return nil
+	}
+	if err := b.Delete(ctx, backup.Manifest); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete manifest: %w", err)
+	}
+	return nil
+}
+
+// applyPolicy decides which of the given backups the policy retains. The backups of each volume are considered
+// from the newest to the oldest, and the decisions are returned in that order, grouped by volume.
+func applyPolicy(policy Policy, backups []Backup) []PruneDecision {
+	byVolume := map[string][]Backup{}
+	var volumes []string
+	for _, backup := range backups {
+		if _, ok := byVolume[backup.Volume]; !ok {
+			volumes = append(volumes, backup.Volume)
+		}
+		byVolume[backup.Volume] = append(byVolume[backup.Volume], backup)
+	}
+	sort.Strings(volumes)
+
+	decisions := []PruneDecision{}
+	for _, volume := range volumes {
+		vb := byVolume[volume]
+		sort.SliceStable(vb, func(i, j int) bool { return vb[i].Time.After(vb[j].Time) })
+
+		rules := policy.rules()
+		kept := make([]int, len(rules))
+		lastKey := make([]string, len(rules))
+		for i, backup := range vb {
+			d := PruneDecision{Backup: backup}
+			if i < policy.KeepLast {
+				d.Reasons = append(d.Reasons, fmt.Sprintf("last %d", policy.KeepLast))
+			}
+			for r, rule := range rules {
+				key := rule.key(backup.Time.Local())
+				if kept[r] < rule.count && key != lastKey[r] {
+					kept[r]++
+					lastKey[r] = key
+					d.Reasons = append(d.Reasons, fmt.Sprintf("%s %s", rule.name, key))
+				}
+			}
+			d.Keep = len(d.Reasons) > 0
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions
+}
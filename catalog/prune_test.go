@@ -0,0 +1,163 @@
+package catalog_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+)
+
+// dailyBackups returns the archive names of daily backups of the volume taken at noon UTC from start, for n days.
+func dailyBackups(volume string, start time.Time, n int) []string {
+	var names []string
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("%s-%d.tar", volume, start.AddDate(0, 0, i).Add(12*time.Hour).Unix()))
+	}
+	return names
+}
+
+// TestPrune verifies that the backups of a volume kept by the policy are recorded with their reasons and the others
+// deleted.
+func TestPrune(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	names := dailyBackups("data", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 70)
+	names = append(names, dailyBackups("db", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 3)...)
+	b := newBackend(t, names...)
+
+	policy := catalog.Policy{KeepLast: 2, KeepDaily: 3, KeepWeekly: 2, KeepMonthly: 2}
+	report, err := catalog.Prune(context.Background(), b, policy, catalog.Filter{Volume: "data"}, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if report.Err() != nil {
+		t.Fatalf("expected no failed deletions, got %s", report.Err())
+	}
+
+	var kept []string
+	for _, d := range report.Decisions {
+		if d.Keep {
+			kept = append(kept, d.Backup.Time.Format("01-02")+" ("+strings.Join(d.Reasons, ", ")+")")
+		}
+	}
+	expected := []string{
+		"03-10 (last 2, daily 2024-03-10, weekly 2024-W10, monthly 2024-03)",
+		"03-09 (last 2, daily 2024-03-09)",
+		"03-08 (daily 2024-03-08)",
+		"03-03 (weekly 2024-W09)",
+		"02-29 (monthly 2024-02)",
+	}
+	if strings.Join(kept, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected kept backups:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(kept, "\n"))
+	}
+	if len(report.Deleted()) != 65 {
+		t.Errorf("expected 65 deleted backups, got %d", len(report.Deleted()))
+	}
+
+	remaining, err := catalog.List(context.Background(), b, catalog.Filter{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(remaining) != 5+3 {
+		t.Errorf("expected the kept backups and the other volume to remain, got %d backups", len(remaining))
+	}
+}
+
+// TestPrune_perVolume verifies that the policy is applied to the backups of each volume separately.
+func TestPrune_perVolume(t *testing.T) {
+	b := newBackend(t, "data-100.tar", "data-200.tar", "db-100.tar", "db-300.tar")
+
+	report, err := catalog.Prune(context.Background(), b, catalog.Policy{KeepLast: 1}, catalog.Filter{}, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var deleted []string
+	for _, d := range report.Deleted() {
+		deleted = append(deleted, d.Backup.Name)
+	}
+	if got := strings.Join(deleted, ", "); got != "data-100.tar, db-100.tar" {
+		t.Errorf("expected the oldest backup of each volume to be deleted, got %s", got)
+	}
+}
+
+// TestPrune_manifest verifies that the manifests of pruned backups are deleted along with them.
+func TestPrune_manifest(t *testing.T) {
+	b := newBackend(t, "data-100.tar", "data-200.tar")
+	putManifest(t, b, dockerbackup.Manifest{Archive: "data-100.tar"})
+	putManifest(t, b, dockerbackup.Manifest{Archive: "data-200.tar"})
+
+	report, err := catalog.Prune(context.Background(), b, catalog.Policy{KeepLast: 1}, catalog.Filter{}, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if report.Err() != nil {
+		t.Fatalf("expected no failed deletions, got %s", report.Err())
+	}
+
+	objects, err := b.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	if got := strings.Join(names, ", "); got != "data-200.tar, data-200.tar.manifest.json" {
+		t.Errorf("expected the pruned backup and its manifest to be deleted, got %s", got)
+	}
+}
+
+// TestPrune_dryRun verifies that a dry run plans the deletions without deleting any backup.
+func TestPrune_dryRun(t *testing.T) {
+	b := newBackend(t, "data-100.tar", "data-200.tar")
+
+	report, err := catalog.Prune(context.Background(), b, catalog.Policy{KeepLast: 1}, catalog.Filter{}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(report.Deleted()) != 1 {
+		t.Errorf("expected one backup to be planned for deletion, got %d", len(report.Deleted()))
+	}
+
+	remaining, _ := catalog.List(context.Background(), b, catalog.Filter{})
+	if len(remaining) != 2 {
+		t.Errorf("expected dry run to keep every backup, got %d", len(remaining))
+	}
+}
+
+// TestPrune_invalidPolicy verifies that empty and negative policies are rejected.
+func TestPrune_invalidPolicy(t *testing.T) {
+	b := newBackend(t, "data-100.tar")
+
+	for _, policy := range []catalog.Policy{{}, {KeepLast: -1}} {
+		if _, err := catalog.Prune(context.Background(), b, policy, catalog.Filter{}, false); err == nil {
+			t.Errorf("expected error for policy %+v, got nil", policy)
+		}
+	}
+}
+
+// TestParsePolicy verifies that retention policies are parsed from their comma-separated form, and invalid ones
+// rejected.
+func TestParsePolicy(t *testing.T) {
+	policy, err := catalog.ParsePolicy("last=3, daily=7,keep-weekly=4,monthly=6,yearly=1")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := catalog.Policy{KeepLast: 3, KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 6, KeepYearly: 1}
+	if policy != expected {
+		t.Errorf("expected %+v, got %+v", expected, policy)
+	}
+
+	for _, s := range []string{"", "last", "hourly=3", "daily=many", "last=-1"} {
+		if _, err := catalog.ParsePolicy(s); err == nil {
+			t.Errorf("expected error for %q, got nil", s)
+		}
+	}
+}
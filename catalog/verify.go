@@ -0,0 +1,236 @@
+package catalog
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// tarTrailerSize is the size of the two zero blocks marking the end of a tar archive.
+const tarTrailerSize = 2 * 512
+
+// VerifyOptions configures the checks run by Verify.
+type VerifyOptions struct {
+	// Identities decrypt encrypted archives so that their content can be checked. Without identities, only the size
+	// and digest of encrypted archives are checked.
+	Identities []age.Identity
+
+	// DigestOnly skips decrypting, decompressing and reading the tar stream, and only checks the size and digest of
+	// the archive against its manifest.
+	DigestOnly bool
+}
+
+// VerifyReport describes the outcome of verifying an archive. The archive is sound when Problems is empty; Warnings
+// list the checks that could not be run.
+type VerifyReport struct {
+	Archive          string              `json:"archive"`
+	Location         string              `json:"location"`
+	Manifest         bool                `json:"manifest"`
+	Size             int64               `json:"size"`
+	SHA256           string              `json:"sha256"`
+	Encrypted        bool                `json:"encrypted"`
+	Compression      archive.Compression `json:"compression,omitempty"`
+	ContentChecked   bool                `json:"content_checked"`
+	FileCount        int64               `json:"file_count"`
+	UncompressedSize int64               `json:"uncompressed_size"`
+	Problems         []string            `json:"problems"`
+	Warnings         []string            `json:"warnings,omitempty"`
+}
+
+// OK reports whether no problem was found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns an error listing the problems found, or nil if the archive is sound.
+func (r *VerifyReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", r.Archive, strings.Join(r.Problems, "; "))
+}
+
+// problem records a problem found in the archive.
+func (r *VerifyReport) problem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// warn records a check that could not be run.
+func (r *VerifyReport) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Verify reads the named archive from b and checks that it can be restored. The archive is streamed once: its size
+// and digest are compared with the manifest stored alongside it, and unless opts.DigestOnly is set, it is decrypted
+// and decompressed and every tar header is read to detect truncation and corruption. Problems are recorded in the
+// report; an error is returned only if the archive cannot be opened.
+func Verify(ctx context.Context, b storage.Backend, name string, opts VerifyOptions) (*VerifyReport, error) {
+	report := &VerifyReport{Archive: name, Location: b.Location(name), Problems: []string{}}
+
+	manifest, err := ReadManifest(ctx, b, name)
+	switch {
+	case err == nil:
+		report.Manifest = true
+	case errors.Is(err, storage.ErrNotFound):
+		report.warn("no manifest stored alongside the archive, the digest cannot be checked")
+	default:
+		report.problem("unreadable manifest: %v", err)
+	}
+
+	rc, err := b.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	hr := &hashingReader{r: rc, h: sha256.New()}
+	if !opts.DigestOnly {
+		report.checkContent(hr, opts.Identities)
+	}
+	// Read what the content checks left unread, such as the padding after the tar stream, so that the digest covers
+	// the whole archive.
+	if _, err := io.Copy(io.Discard, hr); err != nil {
+		report.problem("failed to read archive: %v", err)
+		return report, nil
+	}
+	report.Size = hr.n
+	report.SHA256 = hex.EncodeToString(hr.h.Sum(nil))
+
+	if manifest != nil {
+		report.compare(manifest)
+	}
+	return report, nil
+}
+
+// checkContent decrypts and decompresses the archive read from ar and reads every entry of the tar stream.
+func (r *VerifyReport) checkContent(ar io.Reader, identities []age.Identity) {
+	dr, encrypted, err := archive.Decrypt(ar, identities)
+	r.Encrypted = encrypted
+	if errors.Is(err, archive.ErrMissingIdentity) {
+		r.warn("archive is encrypted and no identity was given, its content cannot be checked")
+		return
+	}
+	if err != nil {
+		r.problem("%v", err)
+		return
+	}
+
+	cr, c, err := archive.NewReader(dr)
+	if err != nil {
+		r.problem("failed to decompress archive: %v", err)
+		return
+	}
+	defer cr.Close()
+	r.Compression = c
+
+	tr := &trailerReader{r: cr}
+	files, err := walkTar(tr)
+	if err != nil {
+		r.problem("corrupt tar stream after %d files: %v", files, err)
+		return
+	}
+	// Read up to the end of the decompressed stream, which also checks the integrity of the compressed and
+	// encrypted streams past the last tar entry.
+	if _, err := io.Copy(io.Discard, tr); err != nil {
+		r.problem("corrupt archive after the end of the tar stream: %v", err)
+		return
+	}
+	if tr.zeros < tarTrailerSize {
+		r.problem("tar stream has no end-of-archive marker, the archive is truncated")
+	}
+
+	r.ContentChecked = true
+	r.FileCount = files
+	r.UncompressedSize = tr.n
+}
+
+// compare checks the archive against the details recorded in its manifest.
+func (r *VerifyReport) compare(m *dockerbackup.Manifest) {
+	if r.Size != m.Size {
+		r.problem("size %d does not match the size %d recorded in the manifest", r.Size, m.Size)
+	}
+	if r.SHA256 != m.SHA256 {
+		r.problem("SHA-256 digest %s does not match the digest %s recorded in the manifest", r.SHA256, m.SHA256)
+	}
+	if !r.ContentChecked {
+		return
+	}
+	if r.Compression != m.Compression {
+		r.problem("compression %s does not match the compression %s recorded in the manifest", r.Compression, m.Compression)
+	}
+	if r.FileCount != m.FileCount {
+		r.problem("%d files do not match the %d files recorded in the manifest", r.FileCount, m.FileCount)
+	}
+	if r.UncompressedSize != m.UncompressedSize {
+		r.problem("tar size %d does not match the size %d recorded in the manifest", r.UncompressedSize, m.UncompressedSize)
+	}
+}
+
+// walkTar reads every header and entry of the tar stream read from r, and returns the number of regular files.
+func walkTar(r io.Reader) (int64, error) {
+	var files int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return files, fmt.Errorf("entry %s: %w", hdr.Name, err)
+		}
+		if hdr.FileInfo().Mode().IsRegular() {
+			files++
+		}
+	}
+}
+
+// hashingReader reads from an underlying reader while counting the bytes and computing their digest.
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+// Read reads from the underlying reader and adds the read bytes to the size and digest.
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.n += int64(n)
+	return n, err
+}
+
+// trailerReader reads from an underlying reader while counting the bytes and the zero bytes ending the stream read
+// so far, which tell whether a tar stream ends with its end-of-archive marker.
+type trailerReader struct {
+	r     io.Reader
+	n     int64
+	zeros int64
+}
+
+// Read reads from the underlying reader and updates the counts.
+func (tr *trailerReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	tr.n += int64(n)
+	for _, c := range p[:n] {
+		if c == 0 {
+			tr.zeros++
+		} else {
+			tr.zeros = 0
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,222 @@
+package catalog_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// buildTar returns a tar stream holding the named files, each with its name as content. Without the end-of-archive
+// marker, the stream stops after the last entry as if it was truncated.
+func buildTar(t *testing.T, marker bool, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var err error
+	if marker {
+		err = tw.Close()
+	} else {
+		err = tw.Flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// nopCloser wraps a writer with a Close method that does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close does nothing and always returns nil.
+func (nopCloser) Close() error {
+	return nil
+}
+
+// encodeArchive compresses and, when e is set, encrypts the tar stream the same way backups are produced.
+func encodeArchive(t *testing.T, tarball []byte, c archive.Compression, e *archive.Encryption) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var ew io.WriteCloser = nopCloser{&buf}
+	if e != nil {
+		var err error
+		if ew, err = e.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cw, err := archive.NewWriter(ew, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cw.Write(tarball); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// storeArchive stores the archive in b under name, along with a manifest recording its size, digest and content.
+func storeArchive(t *testing.T, b storage.Backend, name string, data []byte, c archive.Compression, files int64, tarSize int) {
+	t.Helper()
+	if err := b.Put(context.Background(), name, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	putManifest(t, b, dockerbackup.Manifest{
+		Archive:          name,
+		Size:             int64(len(data)),
+		SHA256:           hex.EncodeToString(sum[:]),
+		Compression:      c,
+		FileCount:        files,
+		UncompressedSize: int64(tarSize),
+	})
+}
+
+// TestVerify verifies that a sound archive passes with its content checked against its manifest.
+func TestVerify(t *testing.T) {
+	b := newBackend(t)
+	tarball := buildTar(t, true, "var/www/data/index.html", "var/www/data/404.html")
+	storeArchive(t, b, "data-100.tar.gz", encodeArchive(t, tarball, archive.Gzip, nil), archive.Gzip, 2, len(tarball))
+
+	report, err := catalog.Verify(context.Background(), b, "data-100.tar.gz", catalog.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !report.OK() || report.Err() != nil {
+		t.Fatalf("expected a sound archive, got problems %v", report.Problems)
+	}
+	if !report.Manifest || !report.ContentChecked || report.Compression != archive.Gzip {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.FileCount != 2 || report.UncompressedSize != int64(len(tarball)) {
+		t.Errorf("expected 2 files and %d bytes, got %d files and %d bytes", len(tarball), report.FileCount, report.UncompressedSize)
+	}
+}
+
+// TestVerify_truncated verifies that a truncated archive is reported as corrupt and as not matching its digest.
+func TestVerify_truncated(t *testing.T) {
+	b := newBackend(t)
+	tarball := buildTar(t, true, "var/www/data/index.html", "var/www/data/404.html")
+	data := encodeArchive(t, tarball, archive.Zstd, nil)
+	storeArchive(t, b, "data-100.tar.zst", data, archive.Zstd, 2, len(tarball))
+	if err := b.Put(context.Background(), "data-100.tar.zst", bytes.NewReader(data[:len(data)/2])); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := catalog.Verify(context.Background(), b, "data-100.tar.zst", catalog.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if report.OK() || report.ContentChecked {
+		t.Fatalf("expected problems, got %+v", report)
+	}
+	problems := strings.Join(report.Problems, "\n")
+	if !strings.Contains(problems, "corrupt") || !strings.Contains(problems, "digest") {
+		t.Errorf("expected corruption and digest problems, got %v", report.Problems)
+	}
+}
+
+// TestVerify_missingMarker verifies that an archive without end-of-archive marker is reported, and a missing manifest
+// warned about.
+func TestVerify_missingMarker(t *testing.T) {
+	b := newBackend(t, "data-100.tar")
+	if err := b.Put(context.Background(), "data-100.tar", bytes.NewReader(buildTar(t, false, "index.html"))); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := catalog.Verify(context.Background(), b, "data-100.tar", catalog.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "end-of-archive") {
+		t.Errorf("expected a missing end-of-archive marker, got %v", report.Problems)
+	}
+	if len(report.Warnings) != 1 || report.Manifest {
+		t.Errorf("expected a warning about the missing manifest, got %v", report.Warnings)
+	}
+}
+
+// TestVerify_encrypted verifies that encrypted archives are checked by digest alone without identity, and by content
+// with one.
+func TestVerify_encrypted(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	encryption, err := archive.NewRecipientEncryption([]string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := newBackend(t)
+	tarball := buildTar(t, true, "index.html")
+	storeArchive(t, b, "data-100.tar.age", encodeArchive(t, tarball, archive.None, encryption), archive.None, 1, len(tarball))
+
+	report, err := catalog.Verify(context.Background(), b, "data-100.tar.age", catalog.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !report.OK() || report.ContentChecked || !report.Encrypted || len(report.Warnings) != 1 {
+		t.Errorf("expected the digest only to be checked without identity, got %+v", report)
+	}
+
+	report, err = catalog.Verify(context.Background(), b, "data-100.tar.age", catalog.VerifyOptions{Identities: []age.Identity{identity}})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !report.OK() || !report.ContentChecked || report.FileCount != 1 {
+		t.Errorf("expected the decrypted content to be checked, got %+v", report)
+	}
+}
+
+// TestVerify_digestMismatch verifies that an archive whose digest differs from its manifest is reported without reading
+// its content.
+func TestVerify_digestMismatch(t *testing.T) {
+	b := newBackend(t)
+	tarball := buildTar(t, true, "index.html")
+	storeArchive(t, b, "data-100.tar", tarball, archive.None, 1, len(tarball))
+	tampered := bytes.Replace(tarball, []byte("index.html"), []byte("INDEX.html"), -1)
+	if err := b.Put(context.Background(), "data-100.tar", bytes.NewReader(tampered)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := catalog.Verify(context.Background(), b, "data-100.tar", catalog.VerifyOptions{DigestOnly: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "digest") {
+		t.Errorf("expected a digest mismatch, got %v", report.Problems)
+	}
+	if report.ContentChecked {
+		t.Errorf("expected the content not to be checked")
+	}
+}
+
+// TestVerify_notFound verifies that verifying a missing archive fails.
+func TestVerify_notFound(t *testing.T) {
+	if _, err := catalog.Verify(context.Background(), newBackend(t), "data-100.tar", catalog.VerifyOptions{}); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
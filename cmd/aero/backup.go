@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/docker/docker/client"
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/config"
 	"github.com/madalinpopa/aerovault/dockerbackup"
-	"github.com/madalinpopa/aerovault/internal/utils"
+	"github.com/madalinpopa/aerovault/notify"
+	"github.com/madalinpopa/aerovault/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -17,53 +27,277 @@ var backupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "Create a backup tar file for given container container",
 	Run: func(cmd *cobra.Command, args []string) {
-		containerName := getStringFlag(cmd, "container")
-		volumeName := getStringFlag(cmd, "volume")
-		outputPath := getStringFlag(cmd, "output")
-
-		if err := backup(containerName, volumeName, outputPath); err != nil {
-			_, err := fmt.Fprintf(os.Stderr, "Backup failed: %v\n", err)
-			if err != nil {
-				return
-			}
+		cfg := getConfig()
+		opts := backupOptions{
+			cfg:            cfg,
+			containerName:  getStringFlag(cmd, "container"),
+			volumeNames:    getStringArrayFlag(cmd, "volume"),
+			allVolumes:     getBoolFlag(cmd, "all-volumes"),
+			discover:       getBoolFlag(cmd, "discover"),
+			outputPath:     stringSetting(cmd, "output", cfg.Defaults.Destination),
+			outputFormat:   getStringFlag(cmd, "output-format"),
+			compression:    stringSetting(cmd, "compression", cfg.Defaults.Compression),
+			stream:         getBoolFlag(cmd, "stream"),
+			encrypt:        getBoolFlag(cmd, "encrypt"),
+			recipients:     getStringArrayFlag(cmd, "recipient"),
+			passphraseFile: getStringFlag(cmd, "passphrase-file"),
+			consistency:    getStringFlag(cmd, "consistency"),
+			preExec:        getStringArrayFlag(cmd, "pre-exec"),
+			postExec:       getStringArrayFlag(cmd, "post-exec"),
+		}
+		// The configured consistency mode only applies to backups going through a container.
+		if opts.containerName != "" || opts.discover {
+			opts.consistency = stringSetting(cmd, "consistency", cfg.Defaults.Consistency)
+		}
+		encryptionFlags := cmd.Flags().Changed("encrypt") || cmd.Flags().Changed("recipient") || cmd.Flags().Changed("passphrase-file")
+		if enc := cfg.Defaults.Encryption; enc != nil && !encryptionFlags {
+			opts.encrypt = true
+			opts.recipients = enc.Recipients
+			opts.passphraseFile = enc.PassphraseFile
+		}
+
+		start := time.Now()
+		reports, err := backup(opts)
+		event := notify.NewEvent("", start, time.Now(), reports, err)
+		if err := notify.Dispatch(context.Background(), cfg.Defaults.Notify, event); err != nil {
+			slog.Error("notification failed", "error", err)
+		}
+		if err != nil {
+			slog.Error("backup failed", "error", err)
 			os.Exit(1)
 		}
 	},
 }
 
+// backupOptions holds the values of the flags accepted by the backup command, completed by the configuration.
+type backupOptions struct {
+	cfg            *config.Config
+	containerName  string
+	volumeNames    []string
+	allVolumes     bool
+	discover       bool
+	outputPath     string
+	outputFormat   string
+	compression    string
+	stream         bool
+	encrypt        bool
+	recipients     []string
+	passphraseFile string
+	consistency    string
+	preExec        []string
+	postExec       []string
+}
+
 // init initializes the backup command by setting up flags and marking required ones. Adds the command to rootCmd.
 func init() {
 	var containerName string
-	var volumeName string
+	var volumeNames []string
+	var allVolumes bool
+	var discover bool
 	var outputPath string
+	var outputFormat string
+	var compression string
+	var stream bool
+	var encrypt bool
+	var recipients []string
+	var passphraseFile string
+	var consistency string
+	var preExec []string
+	var postExec []string
 
-	backupCmd.Flags().StringVarP(&containerName, "container", "c", "", "Container name (required)")
-	markFlagRequired(backupCmd, "container")
-	backupCmd.Flags().StringVarP(&volumeName, "volume", "v", "", "Volume name (required)")
-	markFlagRequired(backupCmd, "volume")
-	backupCmd.Flags().StringVarP(&outputPath, "output", "o", ".", "Output path")
+	backupCmd.Flags().StringVarP(&containerName, "container", "c", "", "Container name, omit to back up the named volumes directly")
+	backupCmd.Flags().StringArrayVarP(&volumeNames, "volume", "v", nil, "Volume name, can be repeated")
+	backupCmd.Flags().BoolVar(&allVolumes, "all-volumes", false, "Back up every named volume of the container")
+	backupCmd.Flags().BoolVar(&discover, "discover", false, "Back up every running container labeled "+dockerbackup.LabelEnable+"=true")
+	backupCmd.MarkFlagsMutuallyExclusive("volume", "all-volumes", "discover")
+	backupCmd.MarkFlagsMutuallyExclusive("container", "discover")
+	backupCmd.MarkFlagsOneRequired("volume", "all-volumes", "discover")
+	backupCmd.Flags().StringVarP(&outputPath, "output", "o", ".", "Output path, storage URL such as file:///srv/backups, or configured destination")
+	backupCmd.Flags().StringVar(&outputFormat, "output-format", outputFormatText, "Format of the backup result: text or json")
+	backupCmd.Flags().StringVar(&compression, "compression", string(archive.None), "Archive compression: gzip, zstd, xz or none")
+	backupCmd.Flags().BoolVar(&stream, "stream", false, "Stream the archive through the Docker API, implied for remote daemons")
+	backupCmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the archive with age before it is stored")
+	backupCmd.Flags().StringArrayVarP(&recipients, "recipient", "r", nil, "age public key or recipients file to encrypt to, can be repeated")
+	backupCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase to encrypt with, defaults to "+passphraseEnv)
+	backupCmd.Flags().StringVar(&consistency, "consistency", string(dockerbackup.ConsistencyNone), "Quiesce the container during the backup: none, pause or stop")
+	backupCmd.Flags().StringArrayVar(&preExec, "pre-exec", nil, "Shell command run in the container before the backup, can be repeated, overrides the "+dockerbackup.LabelPreExec+" label")
+	backupCmd.Flags().StringArrayVar(&postExec, "post-exec", nil, "Shell command run in the container after the backup, can be repeated, overrides the "+dockerbackup.LabelPostExec+" label")
 
 	rootCmd.AddCommand(backupCmd)
 }
 
-// backup creates a backup of the specified volume in a given container and writes it to the specified output path.
-// Takes containerName as the name of the container, volumeName as the name of the volume, and outputPath as the output file path.
-// Returns an error if the backup operation fails.
-func backup(containerName string, volumeName string, outputPath string) error {
-	outputPath, err := utils.GetResolvedOutputPath(outputPath)
+// backup creates backups of the volumes selected by opts and stores them in the storage backend addressed by the
+// output path, a path, storage URL or destination of the configuration.
+// When no container is given, the named volumes are backed up directly without going through a container.
+// With discover, every container labeled for aerovault is backed up and printed as a report per container.
+// A single volume is printed as a backup result; several volumes are printed as a report with one entry per volume.
+// Returns the reports of the containers whose volumes were backed up, and an error if any of the backups fails.
+func backup(opts backupOptions) ([]*dockerbackup.BackupReport, error) {
+	if err := validateOutputFormat(opts.outputFormat); err != nil {
+		return nil, err
+	}
+	if opts.allVolumes && opts.containerName == "" {
+		return nil, errors.New("--all-volumes requires a container")
+	}
+	compression, err := archive.ParseCompression(opts.compression)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	encryption, err := newEncryption(opts.encrypt, opts.recipients, opts.passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	consistency, err := dockerbackup.ParseConsistency(opts.consistency)
+	if err != nil {
+		return nil, err
+	}
+	if consistency != dockerbackup.ConsistencyNone && opts.containerName == "" && !opts.discover {
+		return nil, errors.New("--consistency requires a container")
+	}
+	hooks := dockerbackup.Hooks{Pre: opts.preExec, Post: opts.postExec}
+	if !hooks.IsZero() && opts.containerName == "" && !opts.discover {
+		return nil, errors.New("--pre-exec and --post-exec require a container")
 	}
 
+	// Interrupting the backup cancels it, which resumes a paused or stopped container before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	dest, err := openStorage(ctx, opts.cfg, opts.outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBackend(dest)
+
 	cli, err := createDockerClient()
 	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %v", err)
+		return nil, fmt.Errorf("failed to create Docker client: %v", err)
 	}
 	defer closeDockerClient(cli)
 
-	ctx := context.Background()
-	bm := dockerbackup.NewBackupManager(cli, ctx)
-	return bm.BackupVolume(containerName, volumeName, outputPath)
+	bm := dockerbackup.NewBackupManagerWithOptions(cli, ctx, dockerbackup.BackupOptions{
+		Compression: compression,
+		Encryption:  encryption,
+		Stream:      opts.stream || isRemoteDaemon(cli),
+		Consistency: consistency,
+		Hooks:       hooks,
+		Logger:      slog.Default(),
+	})
+
+	if opts.discover {
+		report, err := backupDiscovered(ctx, cli, bm, dest)
+		if err != nil {
+			return nil, err
+		}
+		var reports []*dockerbackup.BackupReport
+		for _, db := range report.Containers {
+			if db.Backup != nil {
+				reports = append(reports, db.Backup)
+			}
+		}
+		if err := printDiscoveryReport(os.Stdout, report, opts.outputFormat); err != nil {
+			return reports, err
+		}
+		return reports, report.Err()
+	}
+
+	if !opts.allVolumes && len(opts.volumeNames) == 1 {
+		var result *dockerbackup.BackupResult
+		if opts.containerName == "" {
+			result, err = bm.BackupNamedVolume(opts.volumeNames[0], dest)
+		} else {
+			result, err = bm.BackupVolume(opts.containerName, opts.volumeNames[0], dest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		reports := []*dockerbackup.BackupReport{{
+			Container: opts.containerName,
+			Volumes:   []dockerbackup.VolumeReport{{Volume: result.Volume, Result: result}},
+		}}
+		return reports, printBackupResult(os.Stdout, result, opts.outputFormat)
+	}
+
+	var report *dockerbackup.BackupReport
+	switch {
+	case opts.allVolumes:
+		report, err = bm.BackupAllVolumes(opts.containerName, dest)
+	case opts.containerName == "":
+		report = bm.BackupNamedVolumes(opts.volumeNames, dest)
+	default:
+		report, err = bm.BackupVolumes(opts.containerName, opts.volumeNames, dest)
+	}
+	// The report is returned along with the error when the container could not be resumed.
+	if report == nil {
+		return nil, err
+	}
+	reports := []*dockerbackup.BackupReport{report}
+	if err := printBackupReport(os.Stdout, report, opts.outputFormat); err != nil {
+		return reports, err
+	}
+	return reports, errors.Join(err, report.Err())
+}
+
+// printBackupResult writes the backup result to w in the given output format.
+func printBackupResult(w io.Writer, result *dockerbackup.BackupResult, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, result)
+	}
+	_, err := fmt.Fprintf(w, "Archive:     %s\nManifest:    %s\nContainer:   %s\nVolume:      %s\nDestination: %s\nStarted:     %s\nFinished:    %s\nFiles:       %d\nTar size:    %d bytes\nSize:        %d bytes\nCompression: %s\nEncryption:  %s\nConsistency: %s\nSHA-256:     %s\n",
+		result.ArchivePath,
+		result.Manifest,
+		valueOrDash(result.Container),
+		result.Volume,
+		result.MountDestination,
+		result.StartTime.Format(time.RFC3339),
+		result.EndTime.Format(time.RFC3339),
+		result.FileCount,
+		result.UncompressedSize,
+		result.Size,
+		result.Compression,
+		valueOrDash(result.Encryption),
+		result.Consistency,
+		result.SHA256,
+	)
+	if err != nil {
+		return err
+	}
+	return printHookResults(w, result.Hooks)
+}
+
+// printBackupReport writes the multi-volume backup report to w in the given output format, one line per volume.
+func printBackupReport(w io.Writer, report *dockerbackup.BackupReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "STATUS\tVOLUME\tARCHIVE\tSIZE\tSHA-256"); err != nil {
+		return err
+	}
+	for _, vr := range report.Volumes {
+		var err error
+		if vr.Err != nil {
+			_, err = fmt.Fprintf(tw, "FAILED\t%s\t%v\t\t\n", vr.Volume, vr.Err)
+		} else {
+			_, err = fmt.Fprintf(tw, "OK\t%s\t%s\t%d\t%s\n", vr.Volume, vr.Result.ArchivePath, vr.Result.Size, vr.Result.SHA256)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return printHookResults(w, report.Hooks)
+}
+
+// printHookResults writes one line per hook that ran, with its exit code.
+func printHookResults(w io.Writer, hooks []dockerbackup.HookResult) error {
+	for _, h := range hooks {
+		if _, err := fmt.Fprintf(w, "Hook:        %s-exec %q exited with code %d\n", h.Phase, h.Command, h.ExitCode); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // getStringFlag retrieves the string value of the specified flag from the given command.
@@ -71,9 +305,40 @@ func backup(containerName string, volumeName string, outputPath string) error {
 func getStringFlag(cmd *cobra.Command, name string) string {
 	value, err := cmd.Flags().GetString(name)
 	if err != nil {
-		if _, err := fmt.Fprintf(os.Stderr, "Error getting %s flag: %v\n", name, err); err != nil {
-			fmt.Println("Failed to print error message")
-		}
+		slog.Error("failed to read flag", "flag", name, "error", err)
+		os.Exit(1)
+	}
+	return value
+}
+
+// getStringArrayFlag retrieves the string array value of the specified flag from the given command.
+// It exits the program if an error occurs while fetching the flag.
+func getStringArrayFlag(cmd *cobra.Command, name string) []string {
+	value, err := cmd.Flags().GetStringArray(name)
+	if err != nil {
+		slog.Error("failed to read flag", "flag", name, "error", err)
+		os.Exit(1)
+	}
+	return value
+}
+
+// getBoolFlag retrieves the boolean value of the specified flag from the given command.
+// It exits the program if an error occurs while fetching the flag.
+func getBoolFlag(cmd *cobra.Command, name string) bool {
+	value, err := cmd.Flags().GetBool(name)
+	if err != nil {
+		slog.Error("failed to read flag", "flag", name, "error", err)
+		os.Exit(1)
+	}
+	return value
+}
+
+// getIntFlag retrieves the integer value of the specified flag from the given command.
+// It exits the program if an error occurs while fetching the flag.
+func getIntFlag(cmd *cobra.Command, name string) int {
+	value, err := cmd.Flags().GetInt(name)
+	if err != nil {
+		slog.Error("failed to read flag", "flag", name, "error", err)
 		os.Exit(1)
 	}
 	return value
@@ -82,7 +347,8 @@ func getStringFlag(cmd *cobra.Command, name string) string {
 // markFlagRequired marks a flag as required for a given Cobra command. Logs and exits on error.
 func markFlagRequired(cmd *cobra.Command, name string) {
 	if err := cmd.MarkFlagRequired(name); err != nil {
-		log.Fatal("Failed to mark flag as required")
+		slog.Error("failed to mark flag as required", "flag", name, "error", err)
+		os.Exit(1)
 	}
 }
 
@@ -91,9 +357,23 @@ func createDockerClient() (*client.Client, error) {
 	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 }
 
+// isRemoteDaemon reports whether the Docker daemon is reached over the network, in which case paths on the local host
+// cannot be bind mounted into containers.
+func isRemoteDaemon(cli *client.Client) bool {
+	host := cli.DaemonHost()
+	return !strings.HasPrefix(host, "unix://") && !strings.HasPrefix(host, "npipe://")
+}
+
 // closeDockerClient closes the provided Docker client and logs an error if the close operation fails.
 func closeDockerClient(cli *client.Client) {
 	if err := cli.Close(); err != nil {
-		fmt.Println("Error closing Docker client:", err)
+		slog.Warn("failed to close Docker client", "error", err)
+	}
+}
+
+// closeBackend releases the connections held by the provided storage backend and logs an error if it fails.
+func closeBackend(b storage.Backend) {
+	if err := storage.Close(b); err != nil {
+		slog.Warn("failed to close storage backend", "error", err)
 	}
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/madalinpopa/aerovault/storage"
+	"github.com/spf13/cobra"
+)
+
+// configPath is the configuration file given by the --config flag of rootCmd.
+var configPath string
+
+// configCmd groups the commands managing the configuration file.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration file",
+}
+
+// configValidateCmd represents the command checking the configuration file for errors.
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file for errors",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configValidate(); err != nil {
+			slog.Error("configuration is invalid", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// init adds the config command and its subcommands to rootCmd.
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// configValidate reads the configuration file and prints a summary of its content, or returns its problems with the
+// line they were found on.
+func configValidate() error {
+	path, _, err := configFile()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s is valid: %d destinations, %d jobs\n", path, len(cfg.Destinations), len(cfg.Jobs))
+	return err
+}
+
+// configFile returns the path of the configuration file: the --config flag, AERO_CONFIG, or the default path. It
+// reports whether the file was given explicitly, rather than being the default.
+func configFile() (string, bool, error) {
+	if configPath != "" {
+		return configPath, true, nil
+	}
+	explicit := os.Getenv(config.EnvPath) != ""
+	path, err := config.DefaultPath()
+	return path, explicit, err
+}
+
+// loadConfig returns the configuration read from the configuration file, with the AERO_* environment variables
+// applied over its defaults. When no file is given and the default file does not exist, the configuration only holds
+// the environment variables.
+func loadConfig() (*config.Config, error) {
+	path, explicit, err := configFile()
+	if err != nil && explicit {
+		return nil, err
+	}
+
+	cfg := &config.Config{}
+	if err == nil {
+		loaded, err := config.Load(path)
+		switch {
+		case err == nil:
+			cfg = loaded
+		case explicit || !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+	}
+	cfg.ApplyEnv()
+	return cfg, nil
+}
+
+// getConfig returns the configuration loaded by loadConfig.
+// It exits the program if an error occurs while loading the configuration.
+func getConfig() *config.Config {
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// stringSetting returns the value of the named flag when it is set on the command line, or else the value from the
+// configuration, environment variables included, when it is not empty, or else the default of the flag.
+func stringSetting(cmd *cobra.Command, name, configured string) string {
+	if cmd.Flags().Changed(name) || configured == "" {
+		return getStringFlag(cmd, name)
+	}
+	return configured
+}
+
+// openStorage returns the backend addressed by s, the name of a destination of the configuration or a path or
+// storage URL, reading the credentials of the destination.
+func openStorage(ctx context.Context, cfg *config.Config, s string) (storage.Backend, error) {
+	dest := cfg.Destination(s)
+	env, err := dest.ResolveCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("destination %s: %w", s, err)
+	}
+	return storage.Open(ctx, dest.URL, storage.WithEnv(env))
+}
+
+// openObject returns the backend holding the object addressed by s, along with the name of the object in that
+// backend. s is the path or storage URL of the object, or the name of a destination of the configuration followed by
+// the object name, such as nas/data-1609459200.tar. The credentials of the destination holding the object are read.
+func openObject(ctx context.Context, cfg *config.Config, s string) (storage.Backend, string, error) {
+	location, name, err := storage.SplitObject(s)
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := openStorage(ctx, cfg, location)
+	return b, name, err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/metrics"
+	"github.com/madalinpopa/aerovault/notify"
+	"github.com/madalinpopa/aerovault/schedule"
+	"github.com/spf13/cobra"
+)
+
+// daemonCmd represents the command running the backup jobs of the configuration file until it is stopped.
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run scheduled backup jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := daemonOptions{
+			cfg:         getConfig(),
+			metricsAddr: getStringFlag(cmd, "metrics-addr"),
+		}
+
+		if err := daemon(opts); err != nil {
+			slog.Error("daemon failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// daemonOptions holds the configuration the daemon command runs the jobs of, and the values of its flags.
+type daemonOptions struct {
+	cfg         *config.Config
+	metricsAddr string
+}
+
+// init initializes the daemon command by setting up flags. Adds the command to rootCmd.
+func init() {
+	var metricsAddr string
+
+	daemonCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, such as :9180")
+
+	rootCmd.AddCommand(daemonCmd)
+}
+
+// daemon runs the jobs of the configuration until the process receives SIGINT or SIGTERM. Backups in progress are
+// allowed to finish before it returns; a second signal terminates the process immediately. The metrics of the jobs
+// are served on the metrics address when it is set.
+func daemon(opts daemonOptions) error {
+	jobs := opts.cfg.ResolvedJobs()
+	if len(jobs) == 0 {
+		return errors.New("no backup jobs are defined in the configuration file, see --config")
+	}
+	// The defaults may have been overridden by environment variables since the file was validated.
+	var errs []error
+	for _, job := range jobs {
+		if err := job.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("job %s: %w", job.Name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	cli, err := createDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Docker client: %v", err)
+	}
+	defer closeDockerClient(cli)
+
+	r := &jobRunner{
+		cfg:     opts.cfg,
+		cli:     cli,
+		stream:  isRemoteDaemon(cli),
+		logger:  slog.Default(),
+		metrics: metrics.New(),
+	}
+	s, err := schedule.New(jobs, r.run, r.logger)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		r.metrics.InitJob(job.Name)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Restore the default behavior so that a second signal terminates the process.
+		stop()
+	}()
+
+	if opts.metricsAddr != "" {
+		srv, err := serveMetrics(opts.metricsAddr, r.metrics, r.logger)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = srv.Close() }()
+	}
+	s.Run(ctx)
+	return nil
+}
+
+// serveMetrics starts serving the metrics at /metrics on addr in the background. Returns an error if addr cannot be
+// listened on.
+func serveMetrics(addr string, m *metrics.Metrics, logger *slog.Logger) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server failed", "error", err)
+		}
+	}()
+	logger.Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", ln.Addr()))
+	return srv, nil
+}
+
+// jobRunner runs the backup jobs of the daemon and records their metrics. Archives are streamed through the Docker
+// API when stream is set, as required by remote daemons.
+type jobRunner struct {
+	cfg     *config.Config
+	cli     dockerbackup.APIClient
+	stream  bool
+	logger  *slog.Logger
+	metrics *metrics.Metrics
+}
+
+// run runs the job, records its outcome and sends it to the notifiers of the job.
+func (r *jobRunner) run(ctx context.Context, job schedule.Job) error {
+	start := time.Now()
+	report, err := r.runJob(ctx, job)
+	r.metrics.ObserveJob(job.Name, err)
+
+	var backups []*dockerbackup.BackupReport
+	if report != nil {
+		backups = append(backups, report)
+	}
+	event := notify.NewEvent(job.Name, start, time.Now(), backups, err)
+	if err := notify.Dispatch(ctx, job.Notify, event); err != nil {
+		r.logger.Error("notification failed", "job", job.Name, "error", err)
+	}
+	return err
+}
+
+// runJob backs up the volumes selected by the job into its destination and logs the outcome of every volume. Once
+// every volume is backed up, the retention policy of the job is applied to the backups of each of its volumes, or of
+// all the volumes of its container when it lists none. Returns the report of the backup, nil when it could not be started.
+func (r *jobRunner) runJob(ctx context.Context, job schedule.Job) (*dockerbackup.BackupReport, error) {
+	compression, err := archive.ParseCompression(job.Compression)
+	if err != nil {
+		return nil, err
+	}
+	consistency := dockerbackup.ConsistencyNone
+	if job.Consistency != "" {
+		if consistency, err = dockerbackup.ParseConsistency(job.Consistency); err != nil {
+			return nil, err
+		}
+	}
+
+	var encryption *archive.Encryption
+	if job.Encryption != nil {
+		if encryption, err = newEncryption(true, job.Encryption.Recipients, job.Encryption.PassphraseFile); err != nil {
+			return nil, err
+		}
+	}
+
+	dest, err := openStorage(ctx, r.cfg, job.Destination)
+	if err != nil {
+		return nil, err
+	}
+	dest = r.metrics.InstrumentBackend(job.Name, dest)
+	defer closeBackend(dest)
+
+	log := r.logger.With("job", job.Name)
+	bm := dockerbackup.NewBackupManagerWithOptions(r.cli, ctx, dockerbackup.BackupOptions{
+		Compression: compression,
+		Encryption:  encryption,
+		Stream:      r.stream,
+		Consistency: consistency,
+		Logger:      log,
+	})
+
+	var report *dockerbackup.BackupReport
+	switch {
+	case job.Container == "":
+		report = bm.BackupNamedVolumes(job.Volumes, dest)
+	case len(job.Volumes) == 0:
+		report, err = bm.BackupAllVolumes(job.Container, dest)
+	default:
+		report, err = bm.BackupVolumes(job.Container, job.Volumes, dest)
+	}
+	if report != nil {
+		r.metrics.ObserveBackups(job.Name, report)
+		for _, vr := range report.Failed() {
+			log.Error("volume backup failed", "volume", vr.Volume, "error", vr.Err)
+		}
+		err = errors.Join(err, report.Err())
+	}
+	if err != nil || job.Retention == "" {
+		return report, err
+	}
+
+	policy, err := catalog.ParsePolicy(job.Retention)
+	if err != nil {
+		return report, err
+	}
+	filters := []catalog.Filter{{Container: job.Container}}
+	if len(job.Volumes) > 0 {
+		filters = filters[:0]
+		for _, v := range job.Volumes {
+			filters = append(filters, catalog.Filter{Container: job.Container, Volume: v})
+		}
+	}
+	var errs []error
+	for _, f := range filters {
+		pr, err := catalog.Prune(ctx, dest, policy, f, false)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.metrics.ObservePrune(job.Name, pr)
+		log.Info("backups pruned", "deleted", len(pr.Deleted()))
+		errs = append(errs, pr.Err())
+	}
+	return report, errors.Join(errs...)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/metrics"
+	"github.com/madalinpopa/aerovault/notify"
+	"github.com/madalinpopa/aerovault/schedule"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// TestJobRunner_notifiesResults verifies that a job without retention sends an event holding the results of its
+// volumes.
+func TestJobRunner_notifiesResults(t *testing.T) {
+	events := make(chan notify.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("expected a JSON event, got %s", err)
+		}
+		events <- e
+	}))
+	defer srv.Close()
+
+	r := &jobRunner{
+		cfg:     &config.Config{},
+		cli:     &dockerStub{},
+		stream:  true,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		metrics: metrics.New(),
+	}
+	job := schedule.Job{
+		Name:        "uploads",
+		Volumes:     []string{"uploads"},
+		Destination: t.TempDir(),
+		Notify:      []notify.Config{{Type: notify.TypeWebhook, URL: srv.URL, On: notify.Always}},
+	}
+	if err := r.run(context.Background(), job); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	e := <-events
+	if e.Status != notify.StatusSuccess || len(e.Backups) != 1 || len(e.Backups[0].Volumes) != 1 {
+		t.Fatalf("expected the results of the volume, got %+v", e)
+	}
+	if vr := e.Backups[0].Volumes[0]; vr.Volume != "uploads" || vr.Result == nil || vr.Result.Size == 0 {
+		t.Errorf("unexpected volume result %+v", vr)
+	}
+}
+
+// TestJobRunner_pruneVolumes verifies that the retention policy of a job listing volumes of a container is applied to
+// the backups of those volumes only.
+func TestJobRunner_pruneVolumes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"data-1609459200.tar", "cache-1609459200.tar", "cache-1609462800.tar"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("archive"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		manifest := `{"manifest_version":1,"archive":"` + name + `","container":{"name":"web"}}`
+		if err := os.WriteFile(filepath.Join(dir, dockerbackup.ManifestName(name)), []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &jobRunner{
+		cfg:     &config.Config{},
+		cli:     &dockerStub{},
+		stream:  true,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		metrics: metrics.New(),
+	}
+	job := schedule.Job{
+		Name:        "web",
+		Container:   "web",
+		Volumes:     []string{"data"},
+		Destination: dir,
+		Retention:   "last=1",
+	}
+	if err := r.run(context.Background(), job); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "data-1609459200.tar")); !os.IsNotExist(err) {
+		t.Errorf("expected the previous backup of data to be pruned")
+	}
+	for _, name := range []string{"cache-1609459200.tar", "cache-1609462800.tar"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected backup %s of a volume outside of the job to be kept, got %s", name, err)
+		}
+	}
+}
+
+// dockerStub is a Docker client serving the backups streamed out of helper containers, holding a single file.
+type dockerStub struct {
+	dockerbackup.APIClient
+}
+
+// ContainerInspect reports the named container as running, with the data and cache volumes mounted.
+func (d *dockerStub) ContainerInspect(_ context.Context, name string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: name, Name: "/" + name, State: &types.ContainerState{Running: true}},
+		Config:            &container.Config{Image: "nginx:1.27"},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeVolume, Name: "data", Destination: "/var/lib/data"},
+			{Type: mount.TypeVolume, Name: "cache", Destination: "/var/cache"},
+		},
+	}, nil
+}
+
+// VolumeInspect reports every volume as existing, with the local driver.
+func (d *dockerStub) VolumeInspect(_ context.Context, name string) (volume.Volume, error) {
+	return volume.Volume{Name: name, Driver: "local"}, nil
+}
+
+// ContainerCreate creates no container, and returns the name of the helper container as its ID.
+func (d *dockerStub) ContainerCreate(_ context.Context, _ *container.Config, _ *container.HostConfig, _ *network.NetworkingConfig, _ *ocispec.Platform, name string) (container.CreateResponse, error) {
+	return container.CreateResponse{ID: name}, nil
+}
+
+// CopyFromContainer returns a tar stream of the srcPath directory holding an index.html file, laid out the same way
+// the Docker daemon does.
+func (d *dockerStub) CopyFromContainer(_ context.Context, _, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	base := path.Base(srcPath)
+	content := "hello"
+	_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: base + "/", Mode: 0o755})
+	_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: base + "/index.html", Mode: 0o644, Size: int64(len(content))})
+	_, _ = tw.Write([]byte(content))
+	if err := tw.Close(); err != nil {
+		return nil, container.PathStat{}, err
+	}
+	return io.NopCloser(&buf), container.PathStat{Name: base, Mode: os.ModeDir}, nil
+}
+
+// ContainerRemove removes nothing, as no container is created.
+func (d *dockerStub) ContainerRemove(context.Context, string, container.RemoveOptions) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// discoveryReport aggregates the outcome of backing up every container discovered through its aerovault labels.
+type discoveryReport struct {
+	Containers []discoveredBackup `json:"containers"`
+}
+
+// discoveredBackup holds the outcome of backing up a discovered container and of applying its retention policy.
+// Err is set when the container could not be backed up at all, such as when its labels are invalid.
+type discoveredBackup struct {
+	Container string
+	Backup    *dockerbackup.BackupReport
+	Prune     *catalog.PruneReport
+	Err       error
+}
+
+// MarshalJSON encodes the container outcome, replacing the error with its message.
+func (db discoveredBackup) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Container string                     `json:"container"`
+		Backup    *dockerbackup.BackupReport `json:"backup,omitempty"`
+		Prune     *catalog.PruneReport       `json:"prune,omitempty"`
+		Error     string                     `json:"error,omitempty"`
+	}{Container: db.Container, Backup: db.Backup, Prune: db.Prune}
+	if db.Err != nil {
+		out.Error = db.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// Err returns an error joining the failures of all containers, volumes and deletions, or nil if everything
+// succeeded.
+func (r *discoveryReport) Err() error {
+	var errs []error
+	for _, db := range r.Containers {
+		err := db.Err
+		if db.Backup != nil {
+			err = errors.Join(err, db.Backup.Err())
+		}
+		if db.Prune != nil {
+			err = errors.Join(err, db.Prune.Err())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %w", db.Container, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backupDiscovered backs up every running container labeled with aerovault.enable=true into dest, with the volumes
+// and compression given by its labels. Once all the volumes of a container are backed up, the retention policy of its
+// aerovault.retention label is applied to its backups in dest. A failing container does not stop the backup of the
+// others; an error is returned only if the containers cannot be listed.
+func backupDiscovered(ctx context.Context, cli dockerbackup.Lister, bm *dockerbackup.BackupManager, dest storage.Backend) (*discoveryReport, error) {
+	containers, err := dockerbackup.DiscoverContainers(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &discoveryReport{Containers: []discoveredBackup{}}
+	for _, dc := range containers {
+		db := discoveredBackup{Container: dc.Name}
+		var policy catalog.Policy
+		if dc.Retention != "" {
+			if policy, err = catalog.ParsePolicy(dc.Retention); err != nil {
+				db.Err = fmt.Errorf("invalid %s label: %w", dockerbackup.LabelRetention, err)
+				report.Containers = append(report.Containers, db)
+				continue
+			}
+		}
+
+		db.Backup, db.Err = bm.BackupDiscovered(dc, dest)
+		// Older backups are only pruned once every volume has a new backup.
+		if db.Err == nil && db.Backup.Err() == nil && !policy.IsZero() {
+			db.Prune, db.Err = catalog.Prune(ctx, dest, policy, catalog.Filter{Container: dc.Name}, false)
+		}
+		report.Containers = append(report.Containers, db)
+	}
+	return report, nil
+}
+
+// printDiscoveryReport writes the discovery report to w in the given output format, with the backup report and the
+// retention decisions of every container.
+func printDiscoveryReport(w io.Writer, report *discoveryReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, report)
+	}
+	if len(report.Containers) == 0 {
+		_, err := fmt.Fprintf(w, "No running containers labeled %s=true\n", dockerbackup.LabelEnable)
+		return err
+	}
+	for i, db := range report.Containers {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "Container: %s\n", db.Container); err != nil {
+			return err
+		}
+		if db.Backup != nil {
+			if err := printBackupReport(w, db.Backup, outputFormatText); err != nil {
+				return err
+			}
+		}
+		if db.Prune != nil {
+			if err := printPruneReport(w, db.Prune, outputFormatText); err != nil {
+				return err
+			}
+		}
+		if db.Err != nil {
+			if _, err := fmt.Fprintf(w, "FAILED: %v\n", db.Err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// passphraseEnv is the environment variable holding the passphrase used when no passphrase file is given.
+const passphraseEnv = "AERO_PASSPHRASE"
+
+// readPassphrase returns the passphrase stored in the named file, without its trailing newline, or the value of the
+// AERO_PASSPHRASE environment variable when no file is given.
+func readPassphrase(passphraseFile string) (string, error) {
+	if passphraseFile == "" {
+		return os.Getenv(passphraseEnv), nil
+	}
+	data, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// newEncryption returns the encryption selected by the backup flags, or nil when encrypt is not set. Archives are
+// encrypted to the given recipients, or with the passphrase when there are none.
+func newEncryption(encrypt bool, recipients []string, passphraseFile string) (*archive.Encryption, error) {
+	if !encrypt {
+		if len(recipients) > 0 || passphraseFile != "" {
+			return nil, errors.New("--recipient and --passphrase-file require --encrypt")
+		}
+		return nil, nil
+	}
+	if len(recipients) > 0 {
+		if passphraseFile != "" {
+			return nil, errors.New("--recipient and --passphrase-file are mutually exclusive")
+		}
+		return archive.NewRecipientEncryption(recipients)
+	}
+
+	passphrase, err := readPassphrase(passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("--encrypt requires --recipient, --passphrase-file or %s", passphraseEnv)
+	}
+	return archive.NewPassphraseEncryption(passphrase)
+}
+
+// loadIdentities returns the identities used to decrypt archives: the keys of the given identity files, and the
+// passphrase read from the passphrase file or AERO_PASSPHRASE if any.
+func loadIdentities(identityFiles []string, passphraseFile string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, name := range identityFiles {
+		ids, err := archive.ParseIdentityFile(name)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, ids...)
+	}
+
+	passphrase, err := readPassphrase(passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		identity, err := archive.PassphraseIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/spf13/cobra"
+)
+
+// listTimeLayout is the layout of the backup timestamps printed by the list command, in local time.
+const listTimeLayout = "2006-01-02 15:04:05 MST"
+
+// listCmd represents the command to enumerate the backups stored in a storage backend.
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the backups stored in a storage backend",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		opts := listOptions{
+			cfg:           cfg,
+			from:          stringSetting(cmd, "from", cfg.Defaults.Destination),
+			volumeName:    getStringFlag(cmd, "volume"),
+			containerName: getStringFlag(cmd, "container"),
+			outputFormat:  getStringFlag(cmd, "output-format"),
+		}
+
+		if err := list(opts); err != nil {
+			slog.Error("list failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// listOptions holds the values of the flags accepted by the list command.
+type listOptions struct {
+	cfg           *config.Config
+	from          string
+	volumeName    string
+	containerName string
+	outputFormat  string
+}
+
+// init initializes the list command by setting up flags. Adds the command to rootCmd.
+func init() {
+	var from string
+	var volumeName string
+	var containerName string
+	var outputFormat string
+
+	listCmd.Flags().StringVar(&from, "from", ".", "Path, storage URL or configured destination holding the backups")
+	listCmd.Flags().StringVarP(&volumeName, "volume", "v", "", "Only list the backups of this volume")
+	listCmd.Flags().StringVarP(&containerName, "container", "c", "", "Only list the backups taken through this container")
+	listCmd.Flags().StringVar(&outputFormat, "output-format", outputFormatText, "Format of the listing: text or json")
+
+	rootCmd.AddCommand(listCmd)
+}
+
+// list prints the backups stored in the storage backend addressed by opts.from that match the volume and container
+// filters.
+func list(opts listOptions) error {
+	if err := validateOutputFormat(opts.outputFormat); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	src, err := openStorage(ctx, opts.cfg, opts.from)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(src)
+
+	backups, err := catalog.List(ctx, src, catalog.Filter{Volume: opts.volumeName, Container: opts.containerName})
+	if err != nil {
+		return err
+	}
+	return printBackups(os.Stdout, backups, opts.outputFormat)
+}
+
+// printBackups writes the listed backups to w in the given output format, one line per backup.
+func printBackups(w io.Writer, backups []catalog.Backup, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, backups)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "VOLUME\tCONTAINER\tTIMESTAMP\tSIZE\tCOMPRESSION\tENCRYPTED\tSHA-256\tARCHIVE"); err != nil {
+		return err
+	}
+	for _, b := range backups {
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			b.Volume,
+			valueOrDash(b.Container),
+			b.Time.Local().Format(listTimeLayout),
+			b.Size,
+			b.Compression,
+			yesNo(b.Encrypted),
+			valueOrDash(b.SHA256),
+			b.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
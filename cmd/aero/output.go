@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// outputFormatText prints results in a human-readable form.
+	outputFormatText = "text"
+
+	// outputFormatJSON prints results as indented JSON, suitable for scripting.
+	outputFormatJSON = "json"
+)
+
+// validateOutputFormat checks that the given output format is one of the supported formats.
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputFormatText, outputFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, expected %q or %q", format, outputFormatText, outputFormatJSON)
+	}
+}
+
+// writeJSON writes the given value to w as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// valueOrDash returns the given value, or a dash if it is empty.
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// yesNo returns "yes" or "no" depending on the given value.
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/spf13/cobra"
+)
+
+// pruneCmd represents the command to delete the backups that fall outside a retention policy.
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete backups that are not retained by a retention policy",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		opts := pruneOptions{
+			cfg:           cfg,
+			from:          stringSetting(cmd, "from", cfg.Defaults.Destination),
+			volumeName:    getStringFlag(cmd, "volume"),
+			containerName: getStringFlag(cmd, "container"),
+			policy: catalog.Policy{
+				KeepLast:    getIntFlag(cmd, "keep-last"),
+				KeepDaily:   getIntFlag(cmd, "keep-daily"),
+				KeepWeekly:  getIntFlag(cmd, "keep-weekly"),
+				KeepMonthly: getIntFlag(cmd, "keep-monthly"),
+				KeepYearly:  getIntFlag(cmd, "keep-yearly"),
+			},
+			dryRun:       getBoolFlag(cmd, "dry-run"),
+			outputFormat: getStringFlag(cmd, "output-format"),
+		}
+
+		if err := prune(opts); err != nil {
+			slog.Error("prune failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// pruneOptions holds the values of the flags accepted by the prune command.
+type pruneOptions struct {
+	cfg           *config.Config
+	from          string
+	volumeName    string
+	containerName string
+	policy        catalog.Policy
+	dryRun        bool
+	outputFormat  string
+}
+
+// init initializes the prune command by setting up flags. Adds the command to rootCmd.
+func init() {
+	var from string
+	var volumeName string
+	var containerName string
+	var keepLast, keepDaily, keepWeekly, keepMonthly, keepYearly int
+	var dryRun bool
+	var outputFormat string
+
+	pruneCmd.Flags().StringVar(&from, "from", ".", "Path, storage URL or configured destination holding the backups")
+	pruneCmd.Flags().StringVarP(&volumeName, "volume", "v", "", "Only prune the backups of this volume")
+	pruneCmd.Flags().StringVarP(&containerName, "container", "c", "", "Only prune the backups taken through this container")
+	pruneCmd.Flags().IntVar(&keepLast, "keep-last", 0, "Keep the N most recent backups of each volume")
+	pruneCmd.Flags().IntVar(&keepDaily, "keep-daily", 0, "Keep the most recent backup of each of the last N days")
+	pruneCmd.Flags().IntVar(&keepWeekly, "keep-weekly", 0, "Keep the most recent backup of each of the last N weeks")
+	pruneCmd.Flags().IntVar(&keepMonthly, "keep-monthly", 0, "Keep the most recent backup of each of the last N months")
+	pruneCmd.Flags().IntVar(&keepYearly, "keep-yearly", 0, "Keep the most recent backup of each of the last N years")
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the retention decisions without deleting anything")
+	pruneCmd.Flags().StringVar(&outputFormat, "output-format", outputFormatText, "Format of the prune report: text or json")
+
+	rootCmd.AddCommand(pruneCmd)
+}
+
+// prune applies the retention policy to the backups of every volume stored in the storage backend addressed by
+// opts.from, and deletes the backups the policy does not retain.
+// Returns an error if any of the deletions fails.
+func prune(opts pruneOptions) error {
+	if err := validateOutputFormat(opts.outputFormat); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	src, err := openStorage(ctx, opts.cfg, opts.from)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(src)
+
+	filter := catalog.Filter{Volume: opts.volumeName, Container: opts.containerName}
+	report, err := catalog.Prune(ctx, src, opts.policy, filter, opts.dryRun)
+	if err != nil {
+		return err
+	}
+	if err := printPruneReport(os.Stdout, report, opts.outputFormat); err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// printPruneReport writes the prune report to w in the given output format, one line per backup.
+func printPruneReport(w io.Writer, report *catalog.PruneReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "ACTION\tVOLUME\tTIMESTAMP\tARCHIVE\tREASON"); err != nil {
+		return err
+	}
+	for _, d := range report.Decisions {
+		action, reason := "keep", strings.Join(d.Reasons, ", ")
+		switch {
+		case d.Keep:
+		case d.Err != nil:
+			action, reason = "failed", d.Err.Error()
+		case report.DryRun:
+			action, reason = "would delete", "not retained by policy"
+		default:
+			action, reason = "delete", "not retained by policy"
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			action, d.Backup.Volume, d.Backup.Time.Local().Format(listTimeLayout), d.Backup.Name, reason)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	summary := "%d backups kept, %d deleted\n"
+	if report.DryRun {
+		summary = "%d backups kept, %d would be deleted\n"
+	}
+	_, err := fmt.Fprintf(w, summary, len(report.Decisions)-len(report.Deleted()), len(report.Deleted()))
+	return err
+}
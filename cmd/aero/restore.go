@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/internal/utils"
+	"github.com/madalinpopa/aerovault/storage"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the command to restore a backup tar file into the volume of a given container.
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a backup tar file into a container volume",
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := restoreOptions{
+			cfg:            getConfig(),
+			containerName:  getStringFlag(cmd, "container"),
+			volumeName:     getStringFlag(cmd, "volume"),
+			archivePath:    getStringFlag(cmd, "file"),
+			from:           getStringFlag(cmd, "from"),
+			force:          getBoolFlag(cmd, "force"),
+			stream:         getBoolFlag(cmd, "stream"),
+			identityFiles:  getStringArrayFlag(cmd, "identity"),
+			passphraseFile: getStringFlag(cmd, "passphrase-file"),
+		}
+
+		if err := restore(opts); err != nil {
+			slog.Error("restore failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// restoreOptions holds the values of the flags accepted by the restore command.
+type restoreOptions struct {
+	cfg            *config.Config
+	containerName  string
+	volumeName     string
+	archivePath    string
+	from           string
+	force          bool
+	stream         bool
+	identityFiles  []string
+	passphraseFile string
+}
+
+// init initializes the restore command by setting up flags and marking required ones. Adds the command to rootCmd.
+func init() {
+	var containerName string
+	var volumeName string
+	var archivePath string
+	var from string
+	var force bool
+	var stream bool
+	var identityFiles []string
+	var passphraseFile string
+
+	restoreCmd.Flags().StringVarP(&containerName, "container", "c", "", "Container name (required)")
+	markFlagRequired(restoreCmd, "container")
+	restoreCmd.Flags().StringVarP(&volumeName, "volume", "v", "", "Volume name (required)")
+	markFlagRequired(restoreCmd, "volume")
+	restoreCmd.Flags().StringVarP(&archivePath, "file", "f", "", "Backup archive to restore, a name within --from when given (required)")
+	markFlagRequired(restoreCmd, "file")
+	restoreCmd.Flags().StringVar(&from, "from", "", "Storage URL or configured destination holding the archive, such as s3://bucket/prefix")
+	restoreCmd.Flags().BoolVar(&force, "force", false, "Overwrite the volume even if it is not empty")
+	restoreCmd.Flags().BoolVar(&stream, "stream", false, "Stream the archive through the Docker API, implied for remote daemons")
+	restoreCmd.Flags().StringArrayVarP(&identityFiles, "identity", "i", nil, "age identity file decrypting the archive, can be repeated")
+	restoreCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase decrypting the archive, defaults to "+passphraseEnv)
+
+	rootCmd.AddCommand(restoreCmd)
+}
+
+// restore extracts the backup archive into the specified volume of a given container. The archive is read from the
+// local path opts.archivePath, or when opts.from is set, from the object of that name in the storage backend at
+// opts.from. Encrypted archives are decrypted with the given identity files or passphrase; when the manifest stored
+// alongside the archive records it as encrypted, missing identities are reported before anything is transferred.
+// Unless force is set, the restore is refused if the volume already contains data.
+// When stream is set, the archive is copied through the Docker API instead of being bind mounted.
+// Returns an error if the restore operation fails.
+func restore(opts restoreOptions) error {
+	ctx := context.Background()
+
+	identities, err := loadIdentities(opts.identityFiles, opts.passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	archivePath := opts.archivePath
+	var src storage.Backend
+	if opts.from != "" {
+		if src, err = openStorage(ctx, opts.cfg, opts.from); err != nil {
+			return err
+		}
+		defer closeBackend(src)
+	} else if archivePath, err = utils.ValidateArchivePath(archivePath); err != nil {
+		return err
+	}
+
+	if err := checkManifest(ctx, src, archivePath, identities); err != nil {
+		return err
+	}
+
+	cli, err := createDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Docker client: %v", err)
+	}
+	defer closeDockerClient(cli)
+
+	rm := dockerbackup.NewRestoreManagerWithOptions(cli, ctx, dockerbackup.RestoreOptions{
+		Identities: identities,
+		Stream:     opts.stream || isRemoteDaemon(cli),
+		Logger:     slog.Default(),
+	})
+	if src == nil {
+		return rm.RestoreVolume(opts.containerName, opts.volumeName, archivePath, opts.force)
+	}
+
+	rc, err := src.Get(ctx, archivePath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return rm.RestoreArchive(opts.containerName, opts.volumeName, rc, opts.force)
+}
+
+// checkManifest reads the manifest stored alongside the archive, from src or next to the local archivePath when src
+// is nil, and refuses to restore an archive the manifest records as encrypted when no identity is given. Archives
+// without a manifest are not checked.
+func checkManifest(ctx context.Context, src storage.Backend, archivePath string, identities []age.Identity) error {
+	var m *dockerbackup.Manifest
+	var err error
+	if src != nil {
+		m, err = catalog.ReadManifest(ctx, src, archivePath)
+	} else {
+		var f *os.File
+		if f, err = os.Open(dockerbackup.ManifestName(archivePath)); err == nil {
+			defer f.Close()
+			m, err = dockerbackup.ReadManifest(f)
+		}
+	}
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if m.Encryption != nil && len(identities) == 0 {
+		return fmt.Errorf("%s was encrypted with %s: %w", archivePath, m.Encryption.Method, archive.ErrMissingIdentity)
+	}
+	return nil
+}
@@ -2,18 +2,45 @@ package main
 
 import (
 	"fmt"
-	"github.com/spf13/cobra"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/spf13/cobra"
+)
+
+// Log formats accepted by --log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logLevel and logFormat hold the values of the logging flags shared by all commands.
+var (
+	logLevel  string
+	logFormat string
 )
 
 // rootCmd is the base command for the CLI application. It prints help information by default when no subcommands are provided.
 var rootCmd = &cobra.Command{
 	Use:   "Usage: aero <command> <args>",
 	Short: "Simple CLI to backup and restore Docker volumes",
+	// Errors are logged by Execute, in the configured log format.
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := newLogger(os.Stderr, logLevel, logFormat)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := cmd.Help(); err != nil {
-			log.Fatal(err)
+			slog.Error("failed to print help", "error", err)
+			os.Exit(1)
 		}
 	},
 }
@@ -21,7 +48,31 @@ var rootCmd = &cobra.Command{
 // Execute runs the root command and handles any errors that occur during execution.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
+
+// init sets up the flags shared by all commands.
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Configuration file, defaults to "+config.EnvPath+" or ~/.config/aerovault/config.yaml")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimum level of the logged events: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logFormatText, "Format of the logged events: text or json")
+}
+
+// newLogger returns a logger writing the events of the given level and above to w, in the given format.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unsupported log level %q, expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %q, expected text or json", format)
+	}
+}
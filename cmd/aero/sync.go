@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/madalinpopa/aerovault/storage"
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the command to replicate backups from one storage backend to another.
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Replicate backups between storage backends",
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := syncOptions{
+			cfg:          getConfig(),
+			from:         getStringFlag(cmd, "from"),
+			to:           getStringFlag(cmd, "to"),
+			prefix:       getStringFlag(cmd, "prefix"),
+			checksum:     getBoolFlag(cmd, "checksum"),
+			delete:       getBoolFlag(cmd, "delete"),
+			dryRun:       getBoolFlag(cmd, "dry-run"),
+			concurrency:  getIntFlag(cmd, "concurrency"),
+			outputFormat: getStringFlag(cmd, "output-format"),
+		}
+
+		if err := syncBackups(opts); err != nil {
+			slog.Error("sync failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// syncOptions holds the values of the flags accepted by the sync command.
+type syncOptions struct {
+	cfg          *config.Config
+	from         string
+	to           string
+	prefix       string
+	checksum     bool
+	delete       bool
+	dryRun       bool
+	concurrency  int
+	outputFormat string
+}
+
+// init initializes the sync command by setting up flags and marking required ones. Adds the command to rootCmd.
+func init() {
+	var from string
+	var to string
+	var prefix string
+	var checksum bool
+	var deleteExtra bool
+	var dryRun bool
+	var concurrency int
+	var outputFormat string
+
+	syncCmd.Flags().StringVar(&from, "from", "", "Source path, storage URL or configured destination (required)")
+	markFlagRequired(syncCmd, "from")
+	syncCmd.Flags().StringVar(&to, "to", "", "Destination path, storage URL or configured destination (required)")
+	markFlagRequired(syncCmd, "to")
+	syncCmd.Flags().StringVar(&prefix, "prefix", "", "Only sync archives whose name starts with the prefix")
+	syncCmd.Flags().BoolVar(&checksum, "checksum", false, "Compare archives of the same size without a manifest by SHA-256 digest")
+	syncCmd.Flags().BoolVar(&deleteExtra, "delete", false, "Delete archives of the destination missing from the source")
+	syncCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the planned changes without applying them")
+	syncCmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of archives copied in parallel")
+	syncCmd.Flags().StringVar(&outputFormat, "output-format", outputFormatText, "Format of the sync report: text or json")
+
+	rootCmd.AddCommand(syncCmd)
+}
+
+// syncBackups copies the archives of the source backend that are missing or differ in the destination backend.
+// With delete, archives of the destination missing from the source are removed. With dryRun, only the plan is printed.
+// Returns an error if any of the archives fails to sync.
+func syncBackups(opts syncOptions) error {
+	if err := validateOutputFormat(opts.outputFormat); err != nil {
+		return err
+	}
+	if opts.concurrency < 1 {
+		return errors.New("--concurrency must be at least 1")
+	}
+
+	ctx := context.Background()
+	src, err := openStorage(ctx, opts.cfg, opts.from)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(src)
+
+	dst, err := openStorage(ctx, opts.cfg, opts.to)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(dst)
+
+	report, err := storage.Sync(ctx, src, dst, storage.SyncOptions{
+		Prefix:      opts.prefix,
+		Checksum:    opts.checksum,
+		Delete:      opts.delete,
+		DryRun:      opts.dryRun,
+		Concurrency: opts.concurrency,
+	})
+	if err != nil {
+		return err
+	}
+	if err := printSyncReport(os.Stdout, report, opts.outputFormat); err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// printSyncReport writes the sync report to w in the given output format, one line per action.
+func printSyncReport(w io.Writer, report *storage.SyncReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "STATUS\tACTION\tARCHIVE\tSIZE\tREASON"); err != nil {
+		return err
+	}
+	for _, a := range report.Actions {
+		status := "OK"
+		reason := a.Reason
+		switch {
+		case report.DryRun:
+			status = "PLANNED"
+		case a.Err != nil:
+			status = "FAILED"
+			reason = a.Err.Error()
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", status, a.Op, a.Name, a.Size, reason); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	summary := "%d archives changed, %d unchanged\n"
+	if report.DryRun {
+		summary = "%d archives to change, %d unchanged\n"
+	}
+	_, err := fmt.Fprintf(w, summary, len(report.Actions), report.Unchanged)
+	return err
+}
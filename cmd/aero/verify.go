@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/config"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the command to check that a stored archive can be restored.
+var verifyCmd = &cobra.Command{
+	Use:   "verify <archive|url>",
+	Short: "Check the integrity of a backup archive",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := verifyOptions{
+			cfg:            getConfig(),
+			archive:        args[0],
+			identityFiles:  getStringArrayFlag(cmd, "identity"),
+			passphraseFile: getStringFlag(cmd, "passphrase-file"),
+			digestOnly:     getBoolFlag(cmd, "digest-only"),
+			outputFormat:   getStringFlag(cmd, "output-format"),
+		}
+
+		if err := verify(opts); err != nil {
+			slog.Error("verify failed", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// verifyOptions holds the values of the arguments and flags accepted by the verify command.
+type verifyOptions struct {
+	cfg            *config.Config
+	archive        string
+	identityFiles  []string
+	passphraseFile string
+	digestOnly     bool
+	outputFormat   string
+}
+
+// init initializes the verify command by setting up flags. Adds the command to rootCmd.
+func init() {
+	var identityFiles []string
+	var passphraseFile string
+	var digestOnly bool
+	var outputFormat string
+
+	verifyCmd.Flags().StringArrayVarP(&identityFiles, "identity", "i", nil, "age identity file decrypting the archive, can be repeated")
+	verifyCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase decrypting the archive, defaults to "+passphraseEnv)
+	verifyCmd.Flags().BoolVar(&digestOnly, "digest-only", false, "Only check the size and digest recorded in the manifest, without reading the tar stream")
+	verifyCmd.Flags().StringVar(&outputFormat, "output-format", outputFormatText, "Format of the verification report: text or json")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// verify checks the archive addressed by opts.archive, a local path, a storage URL such as
+// s3://bucket/prefix/data-1609459200.tar.gz or an archive name within a configured destination, and prints the
+// verification report.
+// Returns an error if the archive cannot be read or has any problem.
+func verify(opts verifyOptions) error {
+	if err := validateOutputFormat(opts.outputFormat); err != nil {
+		return err
+	}
+	identities, err := loadIdentities(opts.identityFiles, opts.passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	src, name, err := openObject(ctx, opts.cfg, opts.archive)
+	if err != nil {
+		return err
+	}
+	defer closeBackend(src)
+
+	report, err := catalog.Verify(ctx, src, name, catalog.VerifyOptions{Identities: identities, DigestOnly: opts.digestOnly})
+	if err != nil {
+		return err
+	}
+	if err := printVerifyReport(os.Stdout, report, opts.outputFormat); err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// printVerifyReport writes the verification report to w in the given output format.
+func printVerifyReport(w io.Writer, report *catalog.VerifyReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSON(w, report)
+	}
+	status := "OK"
+	if !report.OK() {
+		status = "FAILED"
+	}
+	_, err := fmt.Fprintf(w, "Archive:     %s\nManifest:    %s\nSize:        %d bytes\nSHA-256:     %s\nEncrypted:   %s\nCompression: %s\nContent:     %s\n",
+		report.Location,
+		yesNo(report.Manifest),
+		report.Size,
+		report.SHA256,
+		yesNo(report.Encrypted),
+		valueOrDash(string(report.Compression)),
+		contentSummary(report),
+	)
+	if err != nil {
+		return err
+	}
+	for _, warning := range report.Warnings {
+		if _, err := fmt.Fprintf(w, "Warning:     %s\n", warning); err != nil {
+			return err
+		}
+	}
+	for _, problem := range report.Problems {
+		if _, err := fmt.Fprintf(w, "Problem:     %s\n", problem); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "Status:      %s\n", status)
+	return err
+}
+
+// contentSummary describes the tar stream checked by the verification, or that it was not checked.
+func contentSummary(report *catalog.VerifyReport) string {
+	if !report.ContentChecked {
+		return "not checked"
+	}
+	return fmt.Sprintf("%d files, %d bytes", report.FileCount, report.UncompressedSize)
+}
@@ -0,0 +1,423 @@
+// Package config reads the aero configuration file, which defines storage destinations, default backup settings and
+// scheduled backup jobs.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/internal/secret"
+	"github.com/madalinpopa/aerovault/notify"
+	"github.com/madalinpopa/aerovault/schedule"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPath is the environment variable holding the path of the configuration file.
+const EnvPath = "AERO_CONFIG"
+
+// Environment variables overriding the defaults of the configuration file.
+const (
+	EnvDestination    = "AERO_DESTINATION"
+	EnvCompression    = "AERO_COMPRESSION"
+	EnvConsistency    = "AERO_CONSISTENCY"
+	EnvRecipients     = "AERO_RECIPIENTS"
+	EnvPassphraseFile = "AERO_PASSPHRASE_FILE"
+	EnvRetention      = "AERO_RETENTION"
+)
+
+// Config is the content of the configuration file.
+type Config struct {
+	// Path is the file the configuration was read from, empty when no file was read.
+	Path string `yaml:"-"`
+
+	Defaults     Defaults               `yaml:"defaults"`
+	Destinations map[string]Destination `yaml:"destinations"`
+	Jobs         []schedule.Job         `yaml:"jobs"`
+}
+
+// Defaults are the settings used by the backup command and by jobs that do not set them.
+type Defaults struct {
+	// Destination is the name of a destination, or a path or storage URL.
+	Destination string               `yaml:"destination"`
+	Compression string               `yaml:"compression"`
+	Consistency string               `yaml:"consistency"`
+	Encryption  *schedule.Encryption `yaml:"encryption"`
+	Retention   string               `yaml:"retention"`
+
+	// Notify lists the notifiers told about the backups run by the backup command, and by jobs without notifiers.
+	Notify []notify.Config `yaml:"notify"`
+}
+
+// Destination is a named storage location, along with references to the credentials used to access it.
+// Credentials map the environment variables read by the storage backend, such as AWS_SECRET_ACCESS_KEY, to a
+// reference to their value: "env:NAME" for another environment variable, or "file:PATH" for the content of a file.
+type Destination struct {
+	URL         string            `yaml:"url"`
+	Credentials map[string]string `yaml:"credentials"`
+}
+
+// Error is a problem found in the configuration file, located by the line it was found on.
+type Error struct {
+	File string
+	Line int
+
+	// Field is the path of the field in the file, such as jobs[0].schedule, empty for syntax errors.
+	Field string
+
+	Err error
+}
+
+// Error returns the description of the problem prefixed with its location.
+func (e *Error) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s: %v", loc, e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", loc, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// DefaultPath returns the path of the configuration file used when none is given: the value of AERO_CONFIG, or
+// aerovault/config.yaml in the user configuration directory, such as ~/.config/aerovault/config.yaml.
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvPath); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aerovault", "config.yaml"), nil
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	return Parse(path, data)
+}
+
+// Parse decodes and validates the configuration in data, read from the named file. Unknown fields are rejected.
+// Every problem is reported as an *Error, joined into the returned error.
+func Parse(name string, data []byte) (*Config, error) {
+	c := &Config{Path: name}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, syntaxErrors(name, err)
+	}
+	v := &validator{file: name, root: &root}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		// Decoding goes on past unknown fields and mismatched types, so the rest of the file can still be checked.
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, syntaxErrors(name, err)
+		}
+		v.errs = append(v.errs, syntaxErrors(name, err))
+	}
+
+	c.validate(v)
+	if err := errors.Join(v.errs...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// lineError matches the line number of the errors returned by the YAML decoder.
+var lineError = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// syntaxErrors converts an error of the YAML decoder into *Error values located by line.
+func syntaxErrors(file string, err error) error {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+
+	var errs []error
+	for _, msg := range msgs {
+		e := &Error{File: file, Err: errors.New(strings.TrimPrefix(msg, "yaml: "))}
+		if m := lineError.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Err = errors.New(m[2])
+		}
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// validate reports the problems of the configuration to v.
+func (c *Config) validate(v *validator) {
+	d := c.Defaults
+	if _, err := archive.ParseCompression(d.Compression); err != nil {
+		v.report(err, "defaults", "compression")
+	}
+	if d.Consistency != "" {
+		if _, err := dockerbackup.ParseConsistency(d.Consistency); err != nil {
+			v.report(err, "defaults", "consistency")
+		}
+	}
+	if d.Encryption != nil {
+		if err := d.Encryption.Validate(); err != nil {
+			v.report(err, "defaults", "encryption")
+		}
+	}
+	if d.Retention != "" {
+		if _, err := catalog.ParsePolicy(d.Retention); err != nil {
+			v.report(fmt.Errorf("invalid retention: %w", err), "defaults", "retention")
+		}
+	}
+	for i, n := range d.Notify {
+		if err := n.Validate(); err != nil {
+			for _, err := range joinedErrors(err) {
+				v.report(err, "defaults", "notify", i)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(c.Destinations))
+	for name := range c.Destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dest := c.Destinations[name]
+		if dest.URL == "" {
+			v.report(errors.New("url is required"), "destinations", name, "url")
+		} else if strings.Contains(dest.URL, "://") {
+			if _, err := url.Parse(dest.URL); err != nil {
+				v.report(fmt.Errorf("invalid storage URL: %w", err), "destinations", name, "url")
+			}
+		}
+
+		vars := make([]string, 0, len(dest.Credentials))
+		for env := range dest.Credentials {
+			vars = append(vars, env)
+		}
+		sort.Strings(vars)
+		for _, env := range vars {
+			ref := dest.Credentials[env]
+			if _, _, err := secret.Parse(ref); err != nil {
+				v.report(err, "destinations", name, "credentials", env)
+			}
+		}
+	}
+
+	jobNames := make(map[string]bool, len(c.Jobs))
+	for i, job := range c.Jobs {
+		if job.Name != "" && jobNames[job.Name] {
+			v.report(fmt.Errorf("duplicate job name %q", job.Name), "jobs", i, "name")
+		}
+		jobNames[job.Name] = true
+
+		err := c.resolveJob(job).Validate()
+		if err == nil {
+			continue
+		}
+		// Invalid defaults are reported once, rather than for every job inheriting them.
+		inherited := map[string]bool{
+			"compression": job.Compression == "",
+			"consistency": job.Consistency == "",
+			"encryption":  job.Encryption == nil,
+			"retention":   job.Retention == "",
+			"notify":      job.Notify == nil,
+		}
+		for _, err := range joinedErrors(err) {
+			var fieldErr *schedule.FieldError
+			if errors.As(err, &fieldErr) {
+				// Fields of list items are named with their index, such as notify[0].
+				field, index, _ := strings.Cut(fieldErr.Field, "[")
+				if inherited[field] {
+					continue
+				}
+				if n, err := strconv.Atoi(strings.TrimSuffix(index, "]")); err == nil {
+					v.report(fieldErr.Err, "jobs", i, field, n)
+				} else {
+					v.report(fieldErr.Err, "jobs", i, field)
+				}
+			} else {
+				v.report(err, "jobs", i)
+			}
+		}
+	}
+}
+
+// joinedErrors returns the errors joined into err by errors.Join, or err alone when it is not a joined error.
+func joinedErrors(err error) []error {
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		return u.Unwrap()
+	}
+	return []error{err}
+}
+
+// ApplyEnv overrides the defaults with the AERO_* environment variables that are set, which take precedence over
+// the configuration file.
+func (c *Config) ApplyEnv() {
+	set := func(field *string, env string) {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+	set(&c.Defaults.Destination, EnvDestination)
+	set(&c.Defaults.Compression, EnvCompression)
+	set(&c.Defaults.Consistency, EnvConsistency)
+	set(&c.Defaults.Retention, EnvRetention)
+
+	recipients, passphraseFile := os.Getenv(EnvRecipients), os.Getenv(EnvPassphraseFile)
+	if recipients != "" || passphraseFile != "" {
+		enc := &schedule.Encryption{PassphraseFile: passphraseFile}
+		for _, r := range strings.Split(recipients, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				enc.Recipients = append(enc.Recipients, r)
+			}
+		}
+		c.Defaults.Encryption = enc
+	}
+}
+
+// Destination returns the destination named s. When no destination has that name, s is a path or storage URL, and
+// the destination with that URL is returned, or one without credentials.
+func (c *Config) Destination(s string) Destination {
+	if d, ok := c.Destinations[s]; ok {
+		return d
+	}
+	for _, d := range c.Destinations {
+		if d.URL == s {
+			return d
+		}
+	}
+	return Destination{URL: s}
+}
+
+// ResolvedJobs returns the jobs with the defaults applied to the settings they leave empty, and their destinations
+// resolved to paths or storage URLs.
+func (c *Config) ResolvedJobs() []schedule.Job {
+	jobs := make([]schedule.Job, 0, len(c.Jobs))
+	for _, job := range c.Jobs {
+		jobs = append(jobs, c.resolveJob(job))
+	}
+	return jobs
+}
+
+// resolveJob returns the job with the defaults applied and its destination resolved. The default consistency mode
+// only applies to jobs backing up the volumes of a container.
+func (c *Config) resolveJob(job schedule.Job) schedule.Job {
+	if job.Destination == "" {
+		job.Destination = c.Defaults.Destination
+	}
+	// A destination without a URL is reported on its own, the job keeps its name rather than no destination.
+	if url := c.Destination(job.Destination).URL; url != "" {
+		job.Destination = url
+	}
+	if job.Compression == "" {
+		job.Compression = c.Defaults.Compression
+	}
+	if job.Consistency == "" && job.Container != "" {
+		job.Consistency = c.Defaults.Consistency
+	}
+	if job.Encryption == nil {
+		job.Encryption = c.Defaults.Encryption
+	}
+	if job.Retention == "" {
+		job.Retention = c.Defaults.Retention
+	}
+	if job.Notify == nil {
+		job.Notify = c.Defaults.Notify
+	}
+	return job
+}
+
+// ResolveCredentials resolves the credential references of the destination. Returns the values of the environment
+// variables they map, to be read by the storage backend of the destination in place of the process environment.
+func (d Destination) ResolveCredentials() (map[string]string, error) {
+	env := make(map[string]string, len(d.Credentials))
+	for name, ref := range d.Credentials {
+		value, err := secret.Resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("credential %s: %w", name, err)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// validator collects the problems of a configuration, located by line in the parsed document.
+type validator struct {
+	file string
+	root *yaml.Node
+	errs []error
+}
+
+// report records err for the field at path, made of mapping keys and sequence indexes. The problem is located at
+// the line of the field, or of its closest parent present in the file when the field is missing.
+func (v *validator) report(err error, path ...any) {
+	e := &Error{File: v.file, Err: err}
+	node := v.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	e.Line = node.Line
+	for i, elem := range path {
+		switch elem := elem.(type) {
+		case string:
+			if i > 0 {
+				e.Field += "."
+			}
+			e.Field += elem
+		case int:
+			e.Field += fmt.Sprintf("[%d]", elem)
+		}
+		key, value := child(node, elem)
+		if key != nil {
+			e.Line = key.Line
+		}
+		node = value
+	}
+	v.errs = append(v.errs, e)
+}
+
+// child returns the key and value nodes of the mapping key elem of node, or the node of the sequence item elem as
+// both, or nil if there is none.
+func child(node *yaml.Node, elem any) (key, value *yaml.Node) {
+	if node == nil {
+		return nil, nil
+	}
+	switch elem := elem.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == elem {
+				return node.Content[i], node.Content[i+1]
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && elem < len(node.Content) {
+			return node.Content[elem], node.Content[elem]
+		}
+	}
+	return nil, nil
+}
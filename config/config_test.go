@@ -0,0 +1,300 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParse verifies that the destinations, defaults and jobs of a configuration file are read, and that the jobs
+// inherit the defaults and resolve their destinations.
+func TestParse(t *testing.T) {
+	cfg, err := Parse("config.yaml", []byte(`
+defaults:
+  destination: s3
+  compression: zstd
+  consistency: pause
+  encryption:
+    recipients: [age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p]
+  retention: daily=7
+destinations:
+  s3:
+    url: s3://backups/aero?region=eu-west-1
+    credentials:
+      AWS_ACCESS_KEY_ID: env:PROD_AWS_ACCESS_KEY_ID
+      AWS_SECRET_ACCESS_KEY: file:/run/secrets/aws_secret_access_key
+  local:
+    url: /srv/backups
+jobs:
+  - name: postgres
+    schedule: "0 3 * * *"
+    container: postgres
+    volumes: [pgdata]
+  - name: uploads
+    schedule: "@every 6h"
+    volumes: [uploads]
+    destination: local
+    compression: gzip
+    retention: last=3
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(cfg.Destinations) != 2 || cfg.Destinations["s3"].Credentials["AWS_ACCESS_KEY_ID"] != "env:PROD_AWS_ACCESS_KEY_ID" {
+		t.Errorf("unexpected destinations %+v", cfg.Destinations)
+	}
+
+	jobs := cfg.ResolvedJobs()
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	postgres := jobs[0]
+	if postgres.Destination != "s3://backups/aero?region=eu-west-1" || postgres.Compression != "zstd" ||
+		postgres.Consistency != "pause" || postgres.Encryption == nil || postgres.Retention != "daily=7" {
+		t.Errorf("expected the defaults to apply, got %+v", postgres)
+	}
+	uploads := jobs[1]
+	if uploads.Destination != "/srv/backups" || uploads.Compression != "gzip" || uploads.Consistency != "" ||
+		uploads.Retention != "last=3" {
+		t.Errorf("expected the job settings to take precedence, got %+v", uploads)
+	}
+	if cfg.Jobs[0].Destination != "" {
+		t.Errorf("expected the jobs of the file to be left unchanged, got %+v", cfg.Jobs[0])
+	}
+}
+
+// TestParse_empty verifies that an empty file is a valid configuration.
+func TestParse_empty(t *testing.T) {
+	cfg, err := Parse("config.yaml", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(cfg.Jobs) != 0 || len(cfg.Destinations) != 0 {
+		t.Errorf("expected an empty configuration, got %+v", cfg)
+	}
+}
+
+// TestParse_errors verifies that every problem of the configuration is reported with the line it was found on.
+func TestParse_errors(t *testing.T) {
+	_, err := Parse("config.yaml", []byte(`defaults:
+  compression: lz4
+destinations:
+  s3:
+    credentials:
+      AWS_SECRET_ACCESS_KEY: hunter2
+jobs:
+  - name: postgres
+    schedule: "0 25 * * *"
+    container: postgres
+    destination: s3
+  - name: postgres
+    volumes: [uploads]
+    schedule: "@daily"
+    consistency: stop
+`))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, s := range []string{
+		`config.yaml:2: defaults.compression: unsupported compression "lz4"`,
+		"config.yaml:4: destinations.s3.url: url is required",
+		`config.yaml:6: destinations.s3.credentials.AWS_SECRET_ACCESS_KEY: invalid secret reference "hunter2"`,
+		`config.yaml:9: jobs[0].schedule: invalid schedule "0 25 * * *"`,
+		`config.yaml:12: jobs[1].name: duplicate job name "postgres"`,
+		"config.yaml:12: jobs[1].destination: destination is required",
+		"config.yaml:15: jobs[1].consistency: consistency requires a container",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error to contain %q, got:\n%s", s, err)
+		}
+	}
+	if strings.Contains(err.Error(), "jobs[0].compression") {
+		t.Errorf("expected invalid defaults to be reported once, got:\n%s", err)
+	}
+
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) || cfgErr.Line == 0 {
+		t.Errorf("expected a located Error, got %v", err)
+	}
+}
+
+// TestParse_notify verifies that invalid notifiers are located by their index, and that notifiers inherited from the
+// defaults are reported once.
+func TestParse_notify(t *testing.T) {
+	cfg, err := Parse("config.yaml", []byte(`defaults:
+  notify:
+    - type: slack
+      url: env:SLACK_WEBHOOK_URL
+jobs:
+  - name: postgres
+    schedule: "@daily"
+    volumes: [pgdata]
+    destination: /srv/backups
+  - name: uploads
+    schedule: "@daily"
+    volumes: [uploads]
+    destination: /srv/backups
+    notify: []
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	jobs := cfg.ResolvedJobs()
+	if len(jobs[0].Notify) != 1 || jobs[0].Notify[0].Type != "slack" {
+		t.Errorf("expected the default notifier to be inherited, got %+v", jobs[0].Notify)
+	}
+	if len(jobs[1].Notify) != 0 {
+		t.Errorf("expected an empty list to disable the default notifiers, got %+v", jobs[1].Notify)
+	}
+
+	_, err = Parse("config.yaml", []byte(`defaults:
+  notify:
+    - type: pager
+jobs:
+  - name: postgres
+    schedule: "@daily"
+    volumes: [pgdata]
+    destination: /srv/backups
+  - name: uploads
+    schedule: "@daily"
+    volumes: [uploads]
+    destination: /srv/backups
+    notify:
+      - type: webhook
+        url: https://example.com/hook
+      - type: email
+        smtp: smtp.example.com:587
+`))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, s := range []string{
+		`config.yaml:3: defaults.notify[0]: unsupported notifier type "pager"`,
+		"config.yaml:16: jobs[1].notify[1]: from is required",
+		"config.yaml:16: jobs[1].notify[1]: to is required",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error to contain %q, got:\n%s", s, err)
+		}
+	}
+	if strings.Contains(err.Error(), "jobs[0].notify") {
+		t.Errorf("expected invalid defaults to be reported once, got:\n%s", err)
+	}
+}
+
+// TestParse_unknownField verifies that misspelled fields are rejected with their line, along with the other problems
+// of the file.
+func TestParse_unknownField(t *testing.T) {
+	_, err := Parse("config.yaml", []byte(`jobs:
+  - name: postgres
+    shedule: "@daily"
+    volumes: [pgdata]
+    destination: /srv/backups
+`))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "config.yaml:3: field shedule not found") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "config.yaml:2: jobs[0].schedule: invalid schedule") {
+		t.Errorf("expected the rest of the file to be validated, got %v", err)
+	}
+}
+
+// TestParse_syntax verifies that syntax errors are reported with their line.
+func TestParse_syntax(t *testing.T) {
+	_, err := Parse("config.yaml", []byte("defaults:\n  compression: [zstd\n"))
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) || cfgErr.Line == 0 {
+		t.Errorf("expected a located syntax error, got %v", err)
+	}
+}
+
+// TestLoad verifies that the configuration is read from a file and records its path.
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("defaults:\n  compression: xz\n"), 0o600); err != nil {
+		t.Fatalf("failed to write configuration: %s", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cfg.Path != path || cfg.Defaults.Compression != "xz" {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for a missing file, got nil")
+	}
+}
+
+// TestApplyEnv verifies that the environment variables take precedence over the defaults of the file.
+func TestApplyEnv(t *testing.T) {
+	t.Setenv(EnvCompression, "gzip")
+	t.Setenv(EnvDestination, "")
+	t.Setenv(EnvRecipients, "age1a, age1b")
+
+	cfg := &Config{Defaults: Defaults{Destination: "s3", Compression: "zstd", Retention: "last=3"}}
+	cfg.ApplyEnv()
+
+	if cfg.Defaults.Compression != "gzip" || cfg.Defaults.Destination != "s3" || cfg.Defaults.Retention != "last=3" {
+		t.Errorf("unexpected defaults %+v", cfg.Defaults)
+	}
+	if enc := cfg.Defaults.Encryption; enc == nil || len(enc.Recipients) != 2 || enc.Recipients[1] != "age1b" {
+		t.Errorf("expected recipients from the environment, got %+v", enc)
+	}
+}
+
+// TestDestination verifies that destinations are found by name or URL, and that other values are used as URLs.
+func TestDestination(t *testing.T) {
+	cfg := &Config{Destinations: map[string]Destination{
+		"s3": {URL: "s3://backups", Credentials: map[string]string{"AWS_ACCESS_KEY_ID": "env:KEY"}},
+	}}
+
+	if d := cfg.Destination("s3"); d.URL != "s3://backups" {
+		t.Errorf("expected destination by name, got %+v", d)
+	}
+	if d := cfg.Destination("s3://backups"); len(d.Credentials) != 1 {
+		t.Errorf("expected destination by URL with its credentials, got %+v", d)
+	}
+	if d := cfg.Destination("/srv/backups"); d.URL != "/srv/backups" || d.Credentials != nil {
+		t.Errorf("expected a path destination, got %+v", d)
+	}
+}
+
+// TestResolveCredentials verifies that the credential references are resolved without changing the environment.
+func TestResolveCredentials(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %s", err)
+	}
+	t.Setenv("PROD_KEY", "AKIAPROD")
+	t.Setenv("AERO_TEST_KEY", "AKIAOTHER")
+
+	d := Destination{URL: "s3://backups", Credentials: map[string]string{
+		"AERO_TEST_KEY":    "env:PROD_KEY",
+		"AERO_TEST_SECRET": "file:" + secret,
+	}}
+	env, err := d.ResolveCredentials()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := env["AERO_TEST_KEY"]; got != "AKIAPROD" {
+		t.Errorf("expected key from the environment, got %q", got)
+	}
+	if got := env["AERO_TEST_SECRET"]; got != "s3cr3t" {
+		t.Errorf("expected secret from the file, got %q", got)
+	}
+	if got := os.Getenv("AERO_TEST_KEY"); got != "AKIAOTHER" {
+		t.Errorf("expected the environment to be unchanged, got %q", got)
+	}
+
+	d.Credentials = map[string]string{"AERO_TEST_KEY": "env:AERO_TEST_MISSING"}
+	if _, err := d.ResolveCredentials(); err == nil {
+		t.Error("expected error for a missing variable, got nil")
+	}
+}
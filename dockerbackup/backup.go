@@ -3,70 +3,298 @@ package dockerbackup
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/madalinpopa/aerovault/archive"
 )
 
 const (
-	image      = "busybox"
-	backupDir  = "/backup"
-	backupTmpl = "%s-%d"
-	tarCmdTmpl = "tar cvf %s/%s.tar %s"
-	autoRemove = true
+	image             = "busybox"
+	backupDir         = "/backup"
+	volumeMountDir    = "/volume"
+	stagingDirPattern = "aero-backup-*"
+	backupTmpl        = "%s-%d"
+	archiveExt        = ".tar"
+	tarCmdTmpl        = "tar cvf %s/%s %s"
 )
 
 // BackupManager handles backup operations such as creating and inspecting container states.
 type BackupManager struct {
-	cli APIClient
-	ctx context.Context
+	cli    APIClient
+	ctx    context.Context
+	opts   BackupOptions
+	logger *slog.Logger
+}
+
+// BackupOptions configures how the archives of a BackupManager are produced.
+type BackupOptions struct {
+	// Compression is the compression applied to the archives. The zero value produces uncompressed archives.
+	Compression archive.Compression
+
+	// Encryption encrypts the archives after compression. Nil leaves the archives unencrypted.
+	Encryption *archive.Encryption
+
+	// Stream copies the volume content out of the helper container through the Docker API, instead of bind mounting
+	// a staging directory into the helper container. This is required when the Docker daemon runs on another host.
+	Stream bool
+
+	// Consistency pauses or stops the container during the backup of its volumes. It does not apply to named
+	// volumes backed up without a container. The zero value leaves the container running.
+	Consistency Consistency
+
+	// Hooks run inside the container before and after the backup of its volumes, in place of the hooks given by the
+	// aerovault.pre-exec and aerovault.post-exec labels of the container. They do not apply to named volumes backed
+	// up without a container.
+	Hooks Hooks
+
+	// Logger receives an event for every step of the backups, with the container and volume they concern: the
+	// backups and hooks at the info level, and the Docker API calls and uploads at the debug level. Nil discards them.
+	Logger *slog.Logger
+}
+
+// BackupResult describes an archive produced by a successful backup. Archive is the name of the archive in the
+// destination and ArchivePath its location, such as a path on the host. Manifest is the location of the manifest
+// stored alongside the archive.
+type BackupResult struct {
+	Archive          string              `json:"archive"`
+	ArchivePath      string              `json:"archive_path"`
+	Volume           string              `json:"volume"`
+	Container        string              `json:"container,omitempty"`
+	MountDestination string              `json:"mount_destination"`
+	StartTime        time.Time           `json:"start_time"`
+	EndTime          time.Time           `json:"end_time"`
+	Size             int64               `json:"size"`
+	SHA256           string              `json:"sha256"`
+	FileCount        int64               `json:"file_count"`
+	UncompressedSize int64               `json:"uncompressed_size"`
+	Compression      archive.Compression `json:"compression"`
+	Encryption       string              `json:"encryption,omitempty"`
+	Consistency      Consistency         `json:"consistency"`
+	Manifest         string              `json:"manifest"`
+	Hooks            []HookResult        `json:"hooks,omitempty"`
 }
 
 // NewBackupManager initializes and returns a new BackupManager with the provided APIClient and context.
 func NewBackupManager(cli APIClient, ctx context.Context) *BackupManager {
-	return &BackupManager{cli: cli, ctx: ctx}
+	return NewBackupManagerWithOptions(cli, ctx, BackupOptions{})
+}
+
+// NewBackupManagerWithOptions initializes and returns a new BackupManager that produces archives according to opts.
+func NewBackupManagerWithOptions(cli APIClient, ctx context.Context, opts BackupOptions) *BackupManager {
+	if opts.Compression == "" {
+		opts.Compression = archive.None
+	}
+	if opts.Consistency == "" {
+		opts.Consistency = ConsistencyNone
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+	return &BackupManager{cli: cli, ctx: ctx, opts: opts, logger: logger}
 }
 
-// BackupVolume creates a backup of the specified volume in the given container and writes it to the specified output path.
-func (bm *BackupManager) BackupVolume(container, volume, outputPath string) error {
-	m, err := bm.getMountPoint(container, volume)
+// BackupVolume creates a backup of the specified volume in the given container and stores it in dest.
+// The hooks of the container run before and after the backup, and the container is paused or stopped during the
+// backup as selected by the consistency option, and always resumed.
+// It returns a BackupResult describing the produced archive.
+func (bm *BackupManager) BackupVolume(containerName, volume string, dest Destination) (*BackupResult, error) {
+	m, err := bm.getMountPoint(containerName, volume)
 	if err != nil {
+		return nil, err
+	}
+
+	var result *BackupResult
+	hooks, err := bm.withContainer(containerName, func() error {
+		var err error
+		result, err = bm.backup(backupSource{container: containerName, volume: volume, destination: m.Destination}, dest)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return bm.createBackupContainer(container, volume, m.Destination, outputPath)
+	result.Hooks = hooks
+	return result, nil
 }
 
-// createBackupContainer creates a backup of the specified volume by creating a Docker container to tar its contents.
-func (bm *BackupManager) createBackupContainer(volumeFrom, volumeName, destinationPath, hostPath string) error {
-	cmd := generateTarCommand(volumeName, destinationPath)
+// BackupNamedVolume creates a backup of the specified named volume without requiring a container that uses it.
+// The volume is mounted read-only into the helper container, and the archive is stored in dest. The archive records
+// the mount destination of the helper container, which restores strip to extract it into any container mounting the
+// volume.
+func (bm *BackupManager) BackupNamedVolume(volume string, dest Destination) (*BackupResult, error) {
+	bm.logger.Debug("inspecting volume", "volume", volume)
+	v, err := bm.cli.VolumeInspect(bm.ctx, volume)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect volume %s: %w", volume, err)
+	}
+	return bm.backup(backupSource{volume: v.Name, destination: volumeMountDir}, dest)
+}
 
-	config, err := createContainerConfig(image, cmd)
+// backupSource describes the volume to back up and how it is made available to the helper container.
+type backupSource struct {
+	// container is the container whose volumes are shared with the helper container. When empty, the volume is
+	// mounted directly into the helper container.
+	container string
+
+	// volume is the name of the volume.
+	volume string
+
+	// destination is the path at which the volume is mounted inside the helper container.
+	destination string
+}
+
+// logAttrs returns the attributes identifying the source in log events.
+func (src backupSource) logAttrs() []any {
+	if src.container != "" {
+		return []any{"container", src.container, "volume", src.volume}
+	}
+	return []any{"volume", src.volume}
+}
+
+// hostConfig returns the host configuration that makes the source volume available to the helper container.
+func (src backupSource) hostConfig() *container.HostConfig {
+	if src.container != "" {
+		return &container.HostConfig{VolumesFrom: []string{src.container}}
+	}
+	return &container.HostConfig{
+		Mounts: []mount.Mount{{
+			Type:     mount.TypeVolume,
+			Source:   src.volume,
+			Target:   src.destination,
+			ReadOnly: true,
+		}},
+	}
+}
+
+// backup archives the given source into dest and returns a BackupResult describing the archive.
+func (bm *BackupManager) backup(src backupSource, dest Destination) (*BackupResult, error) {
+	start := nowFunc()
+	archiveName := generateArchiveName(src.volume, start) + bm.archiveSuffix()
+	log := bm.logger.With(src.logAttrs()...)
+	log.Info("backup started", "archive", archiveName)
+
+	var stats archiveStats
+	var err error
+	if bm.opts.Stream {
+		stats, err = bm.streamBackup(log, src, archiveName, dest)
+	} else {
+		stats, err = bm.bindBackup(log, src, archiveName, dest)
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	result := &BackupResult{
+		Archive:          archiveName,
+		ArchivePath:      dest.Location(archiveName),
+		Volume:           src.volume,
+		Container:        src.container,
+		MountDestination: src.destination,
+		StartTime:        start,
+		EndTime:          nowFunc(),
+		Size:             stats.size,
+		SHA256:           stats.digest,
+		FileCount:        stats.files,
+		UncompressedSize: stats.uncompressed,
+		Compression:      bm.opts.Compression,
+		Consistency:      ConsistencyNone,
+	}
+	if bm.opts.Encryption != nil {
+		result.Encryption = bm.opts.Encryption.Method()
+	}
+	if src.container != "" {
+		result.Consistency = bm.opts.Consistency
+	}
+
+	manifest := bm.newManifest(src, result, stats)
+	if err := bm.putManifest(dest, manifest); err != nil {
+		return nil, fmt.Errorf("failed to store manifest of archive %s: %w", archiveName, err)
 	}
+	result.Manifest = dest.Location(ManifestName(archiveName))
+	log.Info("backup finished", "archive", result.ArchivePath, "size", result.Size, "duration", result.EndTime.Sub(start))
+	return result, nil
+}
 
-	hostConfig := &container.HostConfig{
-		AutoRemove:  autoRemove,
-		VolumesFrom: []string{volumeFrom},
-		Binds:       []string{fmt.Sprintf("%s:/backup:rw", hostPath)},
+// archiveSuffix returns the suffix appended to the ".tar" extension of the archives, according to their compression
+// and encryption.
+func (bm *BackupManager) archiveSuffix() string {
+	suffix := bm.opts.Compression.Extension()
+	if bm.opts.Encryption != nil {
+		suffix += archive.EncryptedExtension
 	}
+	return suffix
+}
 
-	cr, err := bm.cli.ContainerCreate(bm.ctx, config, hostConfig, nil, nil, "backup-"+volumeName)
+// bindBackup archives the given source by running tar in a helper container that writes the archive into a bind
+// mounted staging directory on the host. The staged archive is then compressed and stored in dest under archiveName.
+// It returns the stats of the stored archive.
+func (bm *BackupManager) bindBackup(log *slog.Logger, src backupSource, archiveName string, dest Destination) (archiveStats, error) {
+	stagingDir, err := os.MkdirTemp("", stagingDirPattern)
 	if err != nil {
-		return fmt.Errorf("failed to create backup container: %w", err)
+		return archiveStats{}, fmt.Errorf("failed to create staging directory: %w", err)
 	}
+	defer os.RemoveAll(stagingDir)
 
-	return bm.cli.ContainerStart(bm.ctx, cr.ID, container.StartOptions{})
+	tarName := strings.TrimSuffix(archiveName, bm.archiveSuffix())
+	if err := bm.createBackupContainer(log, src, tarName, stagingDir); err != nil {
+		return archiveStats{}, err
+	}
+
+	f, err := os.Open(filepath.Join(stagingDir, tarName))
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("failed to open staged archive: %w", err)
+	}
+	defer f.Close()
 
+	stats, err := bm.putArchive(log, dest, archiveName, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("failed to store archive %s: %w", archiveName, err)
+	}
+	return stats, nil
+}
+
+// createBackupContainer creates a backup of the specified volume by running a Docker container to tar its contents.
+// It blocks until the container exits and reports a *ContainerExitError if tar failed.
+func (bm *BackupManager) createBackupContainer(log *slog.Logger, src backupSource, archiveName, hostPath string) error {
+	cmd := generateTarCommand(archiveName, src.destination)
+
+	config, err := createContainerConfig(image, cmd)
+	if err != nil {
+		return err
+	}
+
+	hostConfig := src.hostConfig()
+	hostConfig.Binds = []string{fmt.Sprintf("%s:/backup:rw", hostPath)}
+
+	if err := runHelperContainer(bm.ctx, bm.cli, log, config, hostConfig, helperName("backup", src.volume)); err != nil {
+		return fmt.Errorf("failed to backup volume %s: %w", src.volume, err)
+	}
+	return nil
 }
 
 // getMountPoint retrieves the mount point for a specified volume in a container.
 func (bm *BackupManager) getMountPoint(containerName, volumeName string) (types.MountPoint, error) {
+	bm.logger.Debug("inspecting container", "container", containerName, "volume", volumeName)
+	return findMountPoint(bm.ctx, bm.cli, containerName, volumeName)
+}
 
-	c, err := bm.cli.ContainerInspect(bm.ctx, containerName)
+// findMountPoint inspects the given container and returns the mount point of the named volume.
+func findMountPoint(ctx context.Context, cli Inspector, containerName, volumeName string) (types.MountPoint, error) {
+
+	c, err := cli.ContainerInspect(ctx, containerName)
 	if err != nil {
 		return types.MountPoint{}, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
 	}
@@ -87,10 +315,53 @@ func (bm *BackupManager) getMountPoint(containerName, volumeName string) (types.
 // nowFunc returns the current time, used to generate timestamps for various operations. It can be overridden for testing purposes.
 var nowFunc = time.Now
 
-// generateTarCommand generates a tar command string for creating a tarball of a specified backup in a defined destination path.
-func generateTarCommand(volumeName, destinationPath string) string {
-	backupName := fmt.Sprintf(backupTmpl, volumeName, nowFunc().Unix())
-	return fmt.Sprintf(tarCmdTmpl, backupDir, backupName, destinationPath)
+// generateArchiveName generates the file name of the archive holding the backup of a volume taken at the given time.
+func generateArchiveName(volumeName string, t time.Time) string {
+	return fmt.Sprintf(backupTmpl, volumeName, t.Unix()) + archiveExt
+}
+
+// ArchiveName holds the details encoded in the file name of a backup archive.
+type ArchiveName struct {
+	Volume      string
+	Time        time.Time
+	Compression archive.Compression
+	Encrypted   bool
+}
+
+// ParseArchiveName parses a file name generated for a backup archive, such as data-1609459200.tar.gz.age.
+// It returns an error for names that do not follow the archive naming scheme.
+func ParseArchiveName(name string) (ArchiveName, error) {
+	base := path.Base(name)
+	an := ArchiveName{Compression: archive.None}
+	base, an.Encrypted = strings.CutSuffix(base, archive.EncryptedExtension)
+	for _, c := range []archive.Compression{archive.Gzip, archive.Zstd, archive.Xz} {
+		if strings.HasSuffix(base, archiveExt+c.Extension()) {
+			an.Compression = c
+			base = strings.TrimSuffix(base, c.Extension())
+			break
+		}
+	}
+
+	stem, ok := strings.CutSuffix(base, archiveExt)
+	if !ok {
+		return ArchiveName{}, fmt.Errorf("%s is not a backup archive", name)
+	}
+	i := strings.LastIndexByte(stem, '-')
+	if i <= 0 {
+		return ArchiveName{}, fmt.Errorf("%s is not a backup archive", name)
+	}
+	ts, err := strconv.ParseInt(stem[i+1:], 10, 64)
+	if err != nil {
+		return ArchiveName{}, fmt.Errorf("%s is not a backup archive: invalid timestamp", name)
+	}
+	an.Volume = stem[:i]
+	an.Time = time.Unix(ts, 0)
+	return an, nil
+}
+
+// generateTarCommand generates a tar command string for creating the named archive of a defined destination path.
+func generateTarCommand(archiveName, destinationPath string) string {
+	return fmt.Sprintf(tarCmdTmpl, backupDir, archiveName, destinationPath)
 }
 
 // createContainerConfig generates a Docker container configuration object using the specified image and command.
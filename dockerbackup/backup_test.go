@@ -1,16 +1,32 @@
 package dockerbackup
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"filippo.io/age"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/madalinpopa/aerovault/archive"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -30,12 +46,70 @@ var mockGID = func() int {
 }
 
 // APIClientStub is a stub implementation of the ContainerManager interface for testing purposes.
-type APIClientStub struct{}
+type APIClientStub struct {
+	// exitCode is the status code reported by ContainerWait.
+	exitCode int64
+
+	// stderr is the standard error output reported by ContainerLogs.
+	stderr string
+
+	// removed records the IDs of the removed containers.
+	removed []string
+
+	// volumeFiles is the content of the directory returned by CopyFromContainer, keyed by file name.
+	volumeFiles map[string]string
+
+	// copiedPath and copied record the destination and content of the last CopyToContainer call.
+	copiedPath string
+	copied     []byte
+
+	// restored records the content of the archive bind mounted into the restore helper container when it starts.
+	restored []byte
+
+	// tarContent is written as the archive into the bind mounted backup directory when the container starts.
+	tarContent string
+
+	// config and hostConfig record the configuration of the last created container.
+	config     *container.Config
+	hostConfig *container.HostConfig
+
+	// stopped reports the inspected containers as not running.
+	stopped bool
+
+	// lifecycle records the pause, unpause, stop and start calls made on the inspected containers.
+	lifecycle []string
+
+	// cancelOnPause is called once the container has been paused, to simulate a backup canceled midway.
+	cancelOnPause context.CancelFunc
+
+	// labels are the labels of the inspected containers.
+	labels map[string]string
+
+	// execs records the commands run through the exec API, indexed by exec ID. Each command is also recorded as an
+	// "exec" lifecycle call.
+	execs []string
+
+	// execOutput is the output written by every command run through the exec API, and execExitCodes the exit code of
+	// each command, zero when absent.
+	execOutput    string
+	execExitCodes map[string]int
+
+	// containers is the result of ContainerList, and listOptions records the options it was called with.
+	containers  []types.Container
+	listOptions container.ListOptions
+}
+
+// state returns the state of the inspected containers.
+func (api *APIClientStub) state() *types.ContainerState {
+	return &types.ContainerState{Running: !api.stopped}
+}
 
 // ContainerInspect retrieves detailed information about a container specified by its containerID.
 func (api *APIClientStub) ContainerInspect(_ context.Context, containerID string) (types.ContainerJSON, error) {
 	if containerID == "nginx" {
 		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "4f2a9c", Name: "/nginx", State: api.state()},
+			Config:            &container.Config{Image: "nginx:1.27", Labels: api.labels},
 			Mounts: []types.MountPoint{
 				{
 					Name:        "nginx",
@@ -44,19 +118,229 @@ func (api *APIClientStub) ContainerInspect(_ context.Context, containerID string
 			},
 		}, nil
 	}
+	if containerID == "app" {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "9b1e07", Name: "/app", State: api.state()},
+			Config:            &container.Config{Image: "app:latest", Labels: api.labels},
+			Mounts: []types.MountPoint{
+				{Type: mount.TypeVolume, Name: "db", Destination: "/var/lib/db"},
+				{Type: mount.TypeBind, Source: "/etc/app", Destination: "/etc/app"},
+				{Type: mount.TypeVolume, Name: "cache", Destination: "/var/cache"},
+			},
+		}, nil
+	}
 	return types.ContainerJSON{}, nil
 }
 
+// ContainerList records the options and returns the configured containers.
+func (api *APIClientStub) ContainerList(_ context.Context, options container.ListOptions) ([]types.Container, error) {
+	api.listOptions = options
+	return api.containers, nil
+}
+
+// VolumeInspect returns the volume named "data" and fails for any other volume.
+func (api *APIClientStub) VolumeInspect(_ context.Context, volumeID string) (volume.Volume, error) {
+	if volumeID == "data" {
+		return volume.Volume{Name: "data", Driver: "local", Labels: map[string]string{"app": "web"}}, nil
+	}
+	return volume.Volume{}, errors.New("no such volume: " + volumeID)
+}
+
 // ContainerCreate creates a new container with the provided configuration and returns a creation response or an error.
-func (api *APIClientStub) ContainerCreate(_ context.Context, _ *container.Config, _ *container.HostConfig, _ *network.NetworkingConfig, _ *ocispec.Platform, _ string) (container.CreateResponse, error) {
+func (api *APIClientStub) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, _ *network.NetworkingConfig, _ *ocispec.Platform, _ string) (container.CreateResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return container.CreateResponse{}, err
+	}
+	api.config = config
+	api.hostConfig = hostConfig
 	return container.CreateResponse{}, nil
 }
 
-// ContainerStart starts an existing container based on the provided container ID and start options.
-func (api *APIClientStub) ContainerStart(_ context.Context, _ string, _ container.StartOptions) error {
+// ContainerStart starts an existing container based on the provided container ID and start options. Like the tar
+// command of a backup helper container, it writes the configured archive content into the bind mounted backup
+// directory unless the container is set up to fail; for a restore helper container, it records the content of the
+// bind mounted archive. Helper containers have an empty ID; starting any other container
+// is recorded as a lifecycle call.
+func (api *APIClientStub) ContainerStart(ctx context.Context, containerID string, _ container.StartOptions) error {
+	if containerID != "" {
+		api.lifecycle = append(api.lifecycle, "start "+containerID)
+		return ctx.Err()
+	}
+	if api.exitCode != 0 || api.hostConfig == nil {
+		return nil
+	}
+	for _, bind := range api.hostConfig.Binds {
+		if hostPath, _, ok := strings.Cut(bind, ":"+restoreDir+"/"); ok {
+			data, err := os.ReadFile(hostPath)
+			api.restored = data
+			return err
+		}
+		hostPath, ok := strings.CutSuffix(bind, ":"+backupDir+":rw")
+		if !ok {
+			continue
+		}
+		// The command has the form "tar cvf /backup/<archive> <destination>".
+		archivePath := strings.Fields(api.config.Cmd[2])[2]
+		return os.WriteFile(filepath.Join(hostPath, filepath.Base(archivePath)), []byte(api.tarContent), 0o644)
+	}
+	return nil
+}
+
+// ContainerPause records the pause of the container, then cancels the backup if configured to. It fails if the
+// context is already canceled.
+func (api *APIClientStub) ContainerPause(ctx context.Context, containerID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	api.lifecycle = append(api.lifecycle, "pause "+containerID)
+	if api.cancelOnPause != nil {
+		api.cancelOnPause()
+	}
+	return nil
+}
+
+// ContainerUnpause records the unpause of the container. It fails if the context is canceled.
+func (api *APIClientStub) ContainerUnpause(ctx context.Context, containerID string) error {
+	api.lifecycle = append(api.lifecycle, "unpause "+containerID)
+	return ctx.Err()
+}
+
+// ContainerStop records the stop of the container. It fails if the context is canceled.
+func (api *APIClientStub) ContainerStop(ctx context.Context, containerID string, _ container.StopOptions) error {
+	api.lifecycle = append(api.lifecycle, "stop "+containerID)
+	return ctx.Err()
+}
+
+// ContainerExecCreate records the command run by the exec instance, which is executed through "sh -c".
+func (api *APIClientStub) ContainerExecCreate(ctx context.Context, _ string, options container.ExecOptions) (types.IDResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return types.IDResponse{}, err
+	}
+	api.execs = append(api.execs, options.Cmd[2])
+	api.lifecycle = append(api.lifecycle, "exec "+options.Cmd[2])
+	return types.IDResponse{ID: strconv.Itoa(len(api.execs) - 1)}, nil
+}
+
+// ContainerExecAttach returns a connection streaming the configured exec output multiplexed on stdout, the same
+// way the Docker daemon does.
+func (api *APIClientStub) ContainerExecAttach(_ context.Context, _ string, _ container.ExecAttachOptions) (types.HijackedResponse, error) {
+	server, client := net.Pipe()
+	go func() {
+		defer server.Close()
+		_, _ = stdcopy.NewStdWriter(server, stdcopy.Stdout).Write([]byte(api.execOutput))
+	}()
+	return types.NewHijackedResponse(client, ""), nil
+}
+
+// ContainerExecInspect reports the exec instance as exited with the exit code configured for its command.
+func (api *APIClientStub) ContainerExecInspect(_ context.Context, execID string) (container.ExecInspect, error) {
+	i, err := strconv.Atoi(execID)
+	if err != nil || i >= len(api.execs) {
+		return container.ExecInspect{}, errors.New("no such exec instance: " + execID)
+	}
+	return container.ExecInspect{ExecID: execID, ExitCode: api.execExitCodes[api.execs[i]]}, nil
+}
+
+// ContainerWait reports that the container exited with the configured exit code.
+func (api *APIClientStub) ContainerWait(_ context.Context, _ string, _ container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	statusCh := make(chan container.WaitResponse, 1)
+	statusCh <- container.WaitResponse{StatusCode: api.exitCode}
+	return statusCh, make(chan error)
+}
+
+// ContainerLogs returns the configured stderr output multiplexed the same way the Docker daemon does.
+func (api *APIClientStub) ContainerLogs(_ context.Context, _ string, _ container.LogsOptions) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(api.stderr)); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+// CopyFromContainer returns a tar stream of the srcPath directory holding the configured volume files, laid out
+// the same way the Docker daemon does.
+func (api *APIClientStub) CopyFromContainer(_ context.Context, _, srcPath string) (io.ReadCloser, container.PathStat, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	base := filepath.Base(srcPath)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: base + "/", Mode: 0o755}); err != nil {
+		return nil, container.PathStat{}, err
+	}
+
+	names := make([]string, 0, len(api.volumeFiles))
+	for name := range api.volumeFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := api.volumeFiles[name]
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: base + "/" + name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			return nil, container.PathStat{}, err
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			return nil, container.PathStat{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, container.PathStat{}, err
+	}
+	return io.NopCloser(&buf), container.PathStat{Name: base, Mode: os.ModeDir}, nil
+}
+
+// CopyToContainer records the destination path and the content copied into the container.
+func (api *APIClientStub) CopyToContainer(_ context.Context, _, dstPath string, content io.Reader, _ container.CopyToContainerOptions) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	api.copiedPath = dstPath
+	api.copied = data
+	return nil
+}
+
+// ContainerRemove records the removal of the container with the given ID.
+func (api *APIClientStub) ContainerRemove(_ context.Context, containerID string, _ container.RemoveOptions) error {
+	api.removed = append(api.removed, containerID)
 	return nil
 }
 
+// DestinationStub is an in-memory implementation of the Destination interface for testing purposes.
+type DestinationStub struct {
+	objects map[string][]byte
+
+	// err is returned by Put when set.
+	err error
+
+	// rejected lists object names for which Put fails.
+	rejected []string
+}
+
+// newDestinationStub returns an empty DestinationStub.
+func newDestinationStub() *DestinationStub {
+	return &DestinationStub{objects: map[string][]byte{}}
+}
+
+// Put stores the content read from r under the given name, or returns the configured error.
+func (d *DestinationStub) Put(_ context.Context, name string, r io.Reader) error {
+	if d.err != nil {
+		return d.err
+	}
+	if slices.Contains(d.rejected, name) {
+		return errors.New("rejected " + name)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d.objects[name] = data
+	return nil
+}
+
+// Location returns a stub URL for the named object.
+func (d *DestinationStub) Location(name string) string {
+	return "stub://" + name
+}
+
 // TestNewBackupManager tests the creation of a new BackupManager instance with a stubbed APIClient.
 func TestNewBackupManager(t *testing.T) {
 	ctx := context.Background()
@@ -110,23 +394,332 @@ func TestGetMountPoint_volumeFound(t *testing.T) {
 	}
 }
 
+// TestBackupVolume_success verifies that a backup succeeds once the helper container exits cleanly, that the
+// helper container is removed afterwards and that the result describes the stored archive.
+func TestBackupVolume_success(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{tarContent: "archive"}
+	dest := newDestinationStub()
+	bm := NewBackupManager(cli, context.Background())
+
+	result, err := bm.BackupVolume("nginx", "nginx", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(cli.removed) != 1 {
+		t.Errorf("expected helper container to be removed, got %v", cli.removed)
+	}
+	if data := dest.objects["nginx-1609459200.tar"]; string(data) != "archive" {
+		t.Errorf("expected stored archive 'archive', got %q", data)
+	}
+
+	if result.ArchivePath != "stub://nginx-1609459200.tar" {
+		t.Errorf("expected archive path stub://nginx-1609459200.tar, got %s", result.ArchivePath)
+	}
+	if result.MountDestination != "/var/www/data" {
+		t.Errorf("expected mount destination '/var/www/data', got %s", result.MountDestination)
+	}
+	if result.Size != 7 {
+		t.Errorf("expected size 7, got %d", result.Size)
+	}
+	expectedDigest := "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3"
+	if result.SHA256 != expectedDigest {
+		t.Errorf("expected digest %s, got %s", expectedDigest, result.SHA256)
+	}
+	if !result.StartTime.Equal(mockTimeNow()) {
+		t.Errorf("expected start time %s, got %s", mockTimeNow(), result.StartTime)
+	}
+}
+
+// TestBackupVolume_logs verifies that every step of the backup is logged with the container and volume it concerns.
+func TestBackupVolume_logs(t *testing.T) {
+	var buf bytes.Buffer
+	cli := &APIClientStub{tarContent: "archive"}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{
+		Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+
+	if _, err := bm.BackupVolume("nginx", "nginx", newDestinationStub()); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var messages []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var event map[string]any
+		if err := dec.Decode(&event); err != nil {
+			t.Fatalf("expected JSON events, got %s", err)
+		}
+		messages = append(messages, event["msg"].(string))
+		if event["container"] != "nginx" {
+			t.Errorf("expected event %q to have the container, got %v", event["msg"], event)
+		}
+		if event["msg"] != "inspecting container" && event["volume"] != "nginx" {
+			t.Errorf("expected event %q to have the volume, got %v", event["msg"], event)
+		}
+	}
+	expected := []string{
+		"inspecting container",
+		"backup started",
+		"creating helper container",
+		"starting helper container",
+		"waiting for helper container",
+		"helper container exited",
+		"uploading archive",
+		"archive uploaded",
+		"backup finished",
+	}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected events %v, got %v", expected, messages)
+	}
+}
+
+// TestBackupVolume_failed verifies that a non-zero exit code of the helper container is surfaced as a
+// ContainerExitError carrying the exit code and captured stderr.
+func TestBackupVolume_failed(t *testing.T) {
+	cli := &APIClientStub{exitCode: 1, stderr: "tar: can't open '/var/www/data': No such file or directory\n"}
+	dest := newDestinationStub()
+	bm := NewBackupManager(cli, context.Background())
+
+	_, err := bm.BackupVolume("nginx", "nginx", dest)
+
+	var exitErr *ContainerExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected ContainerExitError, got %v", err)
+	}
+	if exitErr.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", exitErr.ExitCode)
+	}
+	if exitErr.Stderr != "tar: can't open '/var/www/data': No such file or directory" {
+		t.Errorf("unexpected stderr %q", exitErr.Stderr)
+	}
+	if len(cli.removed) != 1 {
+		t.Errorf("expected helper container to be removed, got %v", cli.removed)
+	}
+	if len(dest.objects) != 0 {
+		t.Errorf("expected nothing to be stored, got %d objects", len(dest.objects))
+	}
+}
+
+// TestBackupVolume_compressed verifies that the archive is compressed before it is stored.
+func TestBackupVolume_compressed(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	dest := newDestinationStub()
+	bm := NewBackupManagerWithOptions(&APIClientStub{tarContent: "archive"}, context.Background(), BackupOptions{Compression: archive.Zstd})
+	result, err := bm.BackupVolume("nginx", "nginx", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if result.ArchivePath != "stub://nginx-1609459200.tar.zst" {
+		t.Errorf("expected archive path stub://nginx-1609459200.tar.zst, got %s", result.ArchivePath)
+	}
+	if result.Compression != archive.Zstd {
+		t.Errorf("expected compression zstd, got %s", result.Compression)
+	}
+
+	stored := dest.objects["nginx-1609459200.tar.zst"]
+	if int64(len(stored)) != result.Size {
+		t.Errorf("expected stored size %d, got %d", result.Size, len(stored))
+	}
+	r, c, err := archive.NewReader(bytes.NewReader(stored))
+	if err != nil || c != archive.Zstd {
+		t.Fatalf("expected zstd archive, got %s (%v)", c, err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "archive" {
+		t.Errorf("expected decompressed content 'archive', got %q", data)
+	}
+}
+
+// TestBackupVolume_encrypted verifies that the archive is compressed and then encrypted before it is stored.
+func TestBackupVolume_encrypted(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	identity, _ := age.GenerateX25519Identity()
+	encryption, err := archive.NewRecipientEncryption([]string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("failed to create encryption: %s", err)
+	}
+
+	dest := newDestinationStub()
+	opts := BackupOptions{Compression: archive.Gzip, Encryption: encryption}
+	bm := NewBackupManagerWithOptions(&APIClientStub{tarContent: "archive"}, context.Background(), opts)
+	result, err := bm.BackupVolume("nginx", "nginx", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if result.Archive != "nginx-1609459200.tar.gz.age" {
+		t.Errorf("expected archive nginx-1609459200.tar.gz.age, got %s", result.Archive)
+	}
+	if result.Encryption != archive.MethodX25519 {
+		t.Errorf("expected encryption %s, got %s", archive.MethodX25519, result.Encryption)
+	}
+
+	dr, encrypted, err := archive.Decrypt(bytes.NewReader(dest.objects[result.Archive]), []age.Identity{identity})
+	if err != nil || !encrypted {
+		t.Fatalf("expected encrypted archive, got encrypted=%t err=%v", encrypted, err)
+	}
+	r, c, err := archive.NewReader(dr)
+	if err != nil || c != archive.Gzip {
+		t.Fatalf("expected gzip archive, got %s (%v)", c, err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "archive" {
+		t.Errorf("expected decrypted content 'archive', got %q", data)
+	}
+}
+
+// TestBackupVolume_putFailure verifies that a failing destination fails the backup.
+func TestBackupVolume_putFailure(t *testing.T) {
+	dest := newDestinationStub()
+	dest.err = errors.New("disk full")
+	bm := NewBackupManager(&APIClientStub{tarContent: "archive"}, context.Background())
+
+	if _, err := bm.BackupVolume("nginx", "nginx", dest); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("expected destination error, got %v", err)
+	}
+}
+
+// TestBackupNamedVolume_success verifies that a named volume is mounted read-only into the helper container
+// without sharing the volumes of a container.
+func TestBackupNamedVolume_success(t *testing.T) {
+	cli := &APIClientStub{tarContent: "archive"}
+	bm := NewBackupManager(cli, context.Background())
+
+	result, err := bm.BackupNamedVolume("data", newDestinationStub())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if len(cli.hostConfig.VolumesFrom) != 0 {
+		t.Errorf("expected no volumes from, got %v", cli.hostConfig.VolumesFrom)
+	}
+	if len(cli.hostConfig.Mounts) != 1 {
+		t.Fatalf("expected one mount, got %v", cli.hostConfig.Mounts)
+	}
+	m := cli.hostConfig.Mounts[0]
+	if m.Type != mount.TypeVolume || m.Source != "data" || m.Target != volumeMountDir || !m.ReadOnly {
+		t.Errorf("unexpected mount %+v", m)
+	}
+	if result.Container != "" {
+		t.Errorf("expected no container, got %s", result.Container)
+	}
+	if result.MountDestination != volumeMountDir {
+		t.Errorf("expected mount destination %s, got %s", volumeMountDir, result.MountDestination)
+	}
+}
+
+// TestBackupNamedVolume_restore verifies that the archive of a named volume, which records the mount destination of
+// the helper container, is restored into the mount destination of the volume in the target container, both with tar
+// in the helper container and with streaming.
+func TestBackupNamedVolume_restore(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	for _, stream := range []bool{false, true} {
+		cli := &APIClientStub{
+			tarContent:  string(testTarball(t, "volume")),
+			volumeFiles: map[string]string{"index.html": "hello"},
+		}
+		bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Stream: stream})
+		dest := newDestinationStub()
+		if _, err := bm.BackupNamedVolume("data", dest); err != nil {
+			t.Fatalf("stream %t: expected no error, got %s", stream, err)
+		}
+		archiveData := dest.objects["data-1609459200.tar"]
+
+		cli = &APIClientStub{}
+		rm := NewRestoreManagerWithOptions(cli, context.Background(), RestoreOptions{Stream: stream})
+		if err := rm.RestoreArchive("nginx", "nginx", bytes.NewReader(archiveData), true); err != nil {
+			t.Fatalf("stream %t: expected no error, got %s", stream, err)
+		}
+
+		restored := cli.restored
+		if stream {
+			restored = cli.copied
+			if cli.copiedPath != "/var/www/data" {
+				t.Errorf("stream %t: expected archive to be copied to /var/www/data, got %s", stream, cli.copiedPath)
+			}
+		} else if cmd := cli.config.Cmd[2]; !strings.HasSuffix(cmd, "-C '/var/www/data'") {
+			t.Errorf("stream %t: expected archive to be extracted into /var/www/data, got %s", stream, cmd)
+		}
+		names := readTarNames(t, bytes.NewReader(restored))
+		if len(names) != 2 || names[0] != "./" || names[1] != "index.html" {
+			t.Errorf("stream %t: expected entries relative to the volume root, got %v", stream, names)
+		}
+	}
+}
+
+// TestBackupNamedVolume_notFound verifies that backing up an unknown volume fails before any container is created.
+func TestBackupNamedVolume_notFound(t *testing.T) {
+	cli := &APIClientStub{}
+	bm := NewBackupManager(cli, context.Background())
+
+	if _, err := bm.BackupNamedVolume("unknown", newDestinationStub()); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if cli.config != nil {
+		t.Errorf("expected no helper container to be created")
+	}
+}
+
 // TestGenerateTarCommand tests the generateTarCommand function
 func TestGenerateTarCommand(t *testing.T) {
 
 	volumeName := "test_volume"
 	destinationPath := "/tmp/destination"
 
-	expectedBackupName := fmt.Sprintf(backupTmpl, volumeName, mockTimeNow().Unix())
-	expectedCommand := fmt.Sprintf(tarCmdTmpl, backupDir, expectedBackupName, destinationPath)
+	expectedArchiveName := fmt.Sprintf(backupTmpl, volumeName, mockTimeNow().Unix()) + archiveExt
+	expectedCommand := fmt.Sprintf(tarCmdTmpl, backupDir, expectedArchiveName, destinationPath)
 
-	nowFunc = mockTimeNow
-	actualCommand := generateTarCommand(volumeName, destinationPath)
+	actualCommand := generateTarCommand(generateArchiveName(volumeName, mockTimeNow()), destinationPath)
 
 	if actualCommand != expectedCommand {
 		t.Errorf("Expected command %s, but got %s", expectedCommand, actualCommand)
 	}
 }
 
+// TestHelperName verifies that helper containers of the same volume are given distinct names.
+func TestHelperName(t *testing.T) {
+	first, second := helperName("backup", "data"), helperName("backup", "data")
+	if !strings.HasPrefix(first, "backup-data-") || !strings.HasPrefix(second, "backup-data-") {
+		t.Errorf("expected names prefixed with backup-data-, got %s and %s", first, second)
+	}
+	if first == second {
+		t.Errorf("expected distinct names, got %s twice", first)
+	}
+}
+
+// TestParseArchiveName verifies that the volume, time and format of an archive are parsed from its name, and that other
+// names are rejected.
+func TestParseArchiveName(t *testing.T) {
+	for name, expected := range map[string]ArchiveName{
+		"data-1609459200.tar":              {Volume: "data", Time: mockTimeNow(), Compression: archive.None},
+		"my-app_db-1609459200.tar.zst":     {Volume: "my-app_db", Time: mockTimeNow(), Compression: archive.Zstd},
+		"hosts/web/v1.2-1609459200.tar.xz": {Volume: "v1.2", Time: mockTimeNow(), Compression: archive.Xz},
+	} {
+		actual, err := ParseArchiveName(name)
+		if err != nil {
+			t.Errorf("expected no error for %s, got %s", name, err)
+			continue
+		}
+		if actual.Volume != expected.Volume || !actual.Time.Equal(expected.Time) || actual.Compression != expected.Compression || actual.Encrypted != expected.Encrypted {
+			t.Errorf("expected %+v for %s, got %+v", expected, name, actual)
+		}
+	}
+
+	for _, name := range []string{"data.tar", "-1609459200.tar", "data-yesterday.tar", "data-1609459200.zip", "notes.txt"} {
+		if _, err := ParseArchiveName(name); err == nil {
+			t.Errorf("expected error for %s, got nil", name)
+		}
+	}
+}
+
 func TestGetUserAndGroup(t *testing.T) {
 	// Override getUID and getGID for the test
 	getUID = mockUID
@@ -2,10 +2,12 @@ package dockerbackup
 
 import (
 	"context"
+	"io"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -15,6 +17,11 @@ type Inspector interface {
 	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
 }
 
+// Lister defines methods to list the containers matching the given options.
+type Lister interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+}
+
 // The Creator defines an interface for creating Docker containers with
 // the specified configurations and context.
 type Creator interface {
@@ -26,9 +33,63 @@ type Starter interface {
 	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
 }
 
-// APIClient defines an interface for container operations including inspect, create, and start.
+// Waiter defines methods to block until a container reaches the given wait condition.
+type Waiter interface {
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+}
+
+// LogReader defines methods to read the output of a container.
+type LogReader interface {
+	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+}
+
+// Remover defines methods to remove a container once it is no longer needed.
+type Remover interface {
+	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+}
+
+// Pauser defines methods to suspend and resume the processes of a container.
+type Pauser interface {
+	ContainerPause(ctx context.Context, containerID string) error
+	ContainerUnpause(ctx context.Context, containerID string) error
+}
+
+// Stopper defines methods to stop a running container.
+type Stopper interface {
+	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+}
+
+// Executor defines methods to run a command inside a running container and read its output and exit code.
+type Executor interface {
+	ContainerExecCreate(ctx context.Context, container string, options container.ExecOptions) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
+}
+
+// VolumeInspector defines methods to inspect a volume using its name.
+type VolumeInspector interface {
+	VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error)
+}
+
+// Copier defines methods to copy files out of and into a container as tar streams.
+type Copier interface {
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, container.PathStat, error)
+	CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options container.CopyToContainerOptions) error
+}
+
+// APIClient defines an interface for container and volume operations including inspect, list, create, start, wait,
+// logs, copy, pause, stop, exec, and remove.
 type APIClient interface {
 	Inspector
+	Lister
+	VolumeInspector
 	Creator
 	Starter
+	Waiter
+	LogReader
+	Copier
+	Pauser
+	Stopper
+	Executor
+	Remover
 }
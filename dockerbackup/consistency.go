@@ -0,0 +1,88 @@
+package dockerbackup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Consistency selects how the container using a volume is quiesced while the volume is archived, so that
+// applications such as databases do not write to the volume during the backup.
+type Consistency string
+
+const (
+	// ConsistencyNone archives the volume while the container keeps running.
+	ConsistencyNone Consistency = "none"
+
+	// ConsistencyPause freezes the processes of the container during the backup and resumes them afterwards.
+	ConsistencyPause Consistency = "pause"
+
+	// ConsistencyStop stops the container during the backup and starts it again afterwards, letting the application
+	// flush its data on shutdown.
+	ConsistencyStop Consistency = "stop"
+)
+
+// ParseConsistency returns the consistency mode named by s.
+func ParseConsistency(s string) (Consistency, error) {
+	switch c := Consistency(s); c {
+	case ConsistencyNone, ConsistencyPause, ConsistencyStop:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported consistency mode %q, expected none, pause or stop", s)
+	}
+}
+
+// quiesce pauses or stops the named container as selected by the consistency option, and returns a function that
+// resumes it. Containers that are not running are left as they are and are not resumed.
+// The returned function must be called once the backup has finished, whether it succeeded or not.
+func (bm *BackupManager) quiesce(containerName string) (func() error, error) {
+	resumed := func() error { return nil }
+	if bm.opts.Consistency == ConsistencyNone {
+		return resumed, nil
+	}
+
+	log := bm.logger.With("container", containerName)
+	log.Debug("inspecting container")
+	c, err := bm.cli.ContainerInspect(bm.ctx, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+	if c.ContainerJSONBase == nil || c.State == nil || !c.State.Running || c.State.Paused {
+		log.Info("container is not running, leaving it as is")
+		return resumed, nil
+	}
+
+	switch bm.opts.Consistency {
+	case ConsistencyPause:
+		log.Info("pausing container")
+		if err := bm.cli.ContainerPause(bm.ctx, containerName); err != nil {
+			return nil, fmt.Errorf("failed to pause container %s: %w", containerName, err)
+		}
+		return func() error {
+			// The container must be resumed even if the backup was canceled.
+			log.Info("unpausing container")
+			if err := bm.cli.ContainerUnpause(context.WithoutCancel(bm.ctx), containerName); err != nil {
+				return fmt.Errorf("failed to unpause container %s: %w", containerName, err)
+			}
+			return nil
+		}, nil
+	case ConsistencyStop:
+		log.Info("stopping container")
+		if err := bm.cli.ContainerStop(bm.ctx, containerName, container.StopOptions{}); err != nil {
+			// A failed stop may still have stopped the container, so make sure it runs again.
+			_ = bm.cli.ContainerStart(context.WithoutCancel(bm.ctx), containerName, container.StartOptions{})
+			return nil, fmt.Errorf("failed to stop container %s: %w", containerName, err)
+		}
+		return func() error {
+			// The container must be restarted even if the backup was canceled.
+			log.Info("starting container")
+			if err := bm.cli.ContainerStart(context.WithoutCancel(bm.ctx), containerName, container.StartOptions{}); err != nil {
+				return fmt.Errorf("failed to start container %s: %w", containerName, err)
+			}
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported consistency mode %q", bm.opts.Consistency)
+	}
+}
@@ -0,0 +1,119 @@
+package dockerbackup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestParseConsistency verifies that the supported consistency modes are parsed and others are rejected.
+func TestParseConsistency(t *testing.T) {
+	for _, s := range []string{"none", "pause", "stop"} {
+		if c, err := ParseConsistency(s); err != nil || string(c) != s {
+			t.Errorf("expected %s, got %s (%v)", s, c, err)
+		}
+	}
+	if _, err := ParseConsistency("freeze"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+// TestBackupVolume_consistency verifies that the container is paused or stopped during the backup, resumed
+// afterwards, and that the mode is recorded in the result.
+func TestBackupVolume_consistency(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	tests := []struct {
+		consistency Consistency
+		lifecycle   []string
+	}{
+		{ConsistencyNone, nil},
+		{ConsistencyPause, []string{"pause nginx", "unpause nginx"}},
+		{ConsistencyStop, []string{"stop nginx", "start nginx"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.consistency), func(t *testing.T) {
+			cli := &APIClientStub{tarContent: "archive"}
+			bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Consistency: tt.consistency})
+
+			result, err := bm.BackupVolume("nginx", "nginx", newDestinationStub())
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if !slices.Equal(cli.lifecycle, tt.lifecycle) {
+				t.Errorf("expected lifecycle %v, got %v", tt.lifecycle, cli.lifecycle)
+			}
+			if result.Consistency != tt.consistency {
+				t.Errorf("expected consistency %s, got %s", tt.consistency, result.Consistency)
+			}
+		})
+	}
+}
+
+// TestBackupVolume_consistencyResumedOnFailure verifies that the container is resumed when the backup fails.
+func TestBackupVolume_consistencyResumedOnFailure(t *testing.T) {
+	cli := &APIClientStub{exitCode: 1}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Consistency: ConsistencyStop})
+
+	var exitErr *ContainerExitError
+	if _, err := bm.BackupVolume("nginx", "nginx", newDestinationStub()); !errors.As(err, &exitErr) {
+		t.Fatalf("expected ContainerExitError, got %v", err)
+	}
+	if expected := []string{"stop nginx", "start nginx"}; !slices.Equal(cli.lifecycle, expected) {
+		t.Errorf("expected lifecycle %v, got %v", expected, cli.lifecycle)
+	}
+}
+
+// TestBackupVolume_consistencyResumedOnCancel verifies that the container is resumed when the backup is canceled
+// while the container is paused.
+func TestBackupVolume_consistencyResumedOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli := &APIClientStub{tarContent: "archive", cancelOnPause: cancel}
+	bm := NewBackupManagerWithOptions(cli, ctx, BackupOptions{Consistency: ConsistencyPause})
+
+	if _, err := bm.BackupVolume("nginx", "nginx", newDestinationStub()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if expected := []string{"pause nginx", "unpause nginx"}; !slices.Equal(cli.lifecycle, expected) {
+		t.Errorf("expected lifecycle %v, got %v", expected, cli.lifecycle)
+	}
+}
+
+// TestBackupVolume_consistencyNotRunning verifies that a container that is not running is neither stopped nor
+// started.
+func TestBackupVolume_consistencyNotRunning(t *testing.T) {
+	cli := &APIClientStub{tarContent: "archive", stopped: true}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Consistency: ConsistencyStop})
+
+	if _, err := bm.BackupVolume("nginx", "nginx", newDestinationStub()); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(cli.lifecycle) != 0 {
+		t.Errorf("expected no lifecycle calls, got %v", cli.lifecycle)
+	}
+}
+
+// TestBackupAllVolumes_consistency verifies that the container is paused once for all its volumes.
+func TestBackupAllVolumes_consistency(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{tarContent: "archive"}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Consistency: ConsistencyPause})
+
+	report, err := bm.BackupAllVolumes("app", newDestinationStub())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if report.Err() != nil {
+		t.Fatalf("expected no failed volumes, got %s", report.Err())
+	}
+	if expected := []string{"pause app", "unpause app"}; !slices.Equal(cli.lifecycle, expected) {
+		t.Errorf("expected lifecycle %v, got %v", expected, cli.lifecycle)
+	}
+}
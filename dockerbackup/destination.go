@@ -0,0 +1,108 @@
+package dockerbackup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log/slog"
+
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// Destination stores the archives produced by a BackupManager. The storage backends satisfy this interface.
+type Destination interface {
+	// Put stores the content read from r under the given name.
+	Put(ctx context.Context, name string, r io.Reader) error
+
+	// Location returns a human-readable location of the named archive, such as a path or a URL.
+	Location(name string) string
+}
+
+// putArchive stores the tar stream produced by writeTar in dest under name, compressed and encrypted as configured.
+// The stream is piped into dest without being buffered on disk. It returns the size and digest of the
+// stored archive along with the file count and size of the tar stream.
+func (bm *BackupManager) putArchive(log *slog.Logger, dest Destination, name string, writeTar func(w io.Writer) error) (archiveStats, error) {
+	log.Debug("uploading archive", "archive", dest.Location(name))
+	pr, pw := io.Pipe()
+	dw := newDigestWriter(pw)
+	tc := newTarCounter()
+
+	done := make(chan error, 1)
+	go func() {
+		err := func() error {
+			defer tc.Close()
+			var ew io.WriteCloser = nopWriteCloser{dw}
+			if bm.opts.Encryption != nil {
+				var err error
+				if ew, err = bm.opts.Encryption.NewWriter(dw); err != nil {
+					return err
+				}
+			}
+			cw, err := archive.NewWriter(ew, bm.opts.Compression)
+			if err != nil {
+				return err
+			}
+			if err := writeTar(io.MultiWriter(cw, tc)); err != nil {
+				return err
+			}
+			if err := cw.Close(); err != nil {
+				return err
+			}
+			return ew.Close()
+		}()
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	putErr := dest.Put(bm.ctx, name, pr)
+	// Unblock the writer in case the destination stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	writeErr := <-done
+
+	// A failing writer also fails Put with the same error, so the Put error covers both sides.
+	if putErr != nil {
+		return archiveStats{}, putErr
+	}
+	if writeErr != nil {
+		return archiveStats{}, writeErr
+	}
+	log.Debug("archive uploaded", "archive", dest.Location(name), "size", dw.n)
+	return archiveStats{size: dw.n, digest: dw.digest(), files: tc.files, uncompressed: tc.n}, nil
+}
+
+// digestWriter writes to an underlying writer while counting the bytes and computing their SHA-256 digest.
+type digestWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+// newDigestWriter returns a digestWriter writing to w.
+func newDigestWriter(w io.Writer) *digestWriter {
+	return &digestWriter{w: w, h: sha256.New()}
+}
+
+// Write writes p to the underlying writer and adds the written bytes to the size and digest.
+func (dw *digestWriter) Write(p []byte) (int, error) {
+	n, err := dw.w.Write(p)
+	dw.h.Write(p[:n])
+	dw.n += int64(n)
+	return n, err
+}
+
+// digest returns the hex encoded SHA-256 digest of the bytes written so far.
+func (dw *digestWriter) digest() string {
+	return hex.EncodeToString(dw.h.Sum(nil))
+}
+
+// nopWriteCloser wraps a writer with a Close method that does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing and always returns nil.
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package dockerbackup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+const (
+	// LabelEnable marks the containers whose volumes are backed up by discovery when set to "true".
+	LabelEnable = "aerovault.enable"
+
+	// LabelVolumes lists the comma separated volumes of a discovered container to back up. All its named volumes are
+	// backed up when the label is absent.
+	LabelVolumes = "aerovault.volumes"
+
+	// LabelCompression sets the compression of the archives of a discovered container.
+	LabelCompression = "aerovault.compression"
+
+	// LabelRetention sets the retention policy applied to the backups of a discovered container, such as
+	// "last=3,daily=7".
+	LabelRetention = "aerovault.retention"
+)
+
+// DiscoveredContainer describes a container annotated for backup with the aerovault labels. Err is set when the
+// labels of the container are invalid, in which case it must not be backed up.
+type DiscoveredContainer struct {
+	Name string
+	ID   string
+
+	// Volumes lists the volumes to back up, empty for all the named volumes of the container.
+	Volumes []string
+
+	// Compression of the archives, empty when the label is absent.
+	Compression archive.Compression
+
+	// Retention is the unparsed retention policy of the backups, empty when the label is absent.
+	Retention string
+
+	Err error
+}
+
+// DiscoverContainers lists the running containers labeled with aerovault.enable=true and reads their backup labels.
+// The containers are sorted by name.
+func DiscoverContainers(ctx context.Context, cli Lister) ([]DiscoveredContainer, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelEnable+"=true")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	discovered := make([]DiscoveredContainer, 0, len(containers))
+	for _, c := range containers {
+		dc := DiscoveredContainer{ID: c.ID, Name: c.ID, Retention: strings.TrimSpace(c.Labels[LabelRetention])}
+		if len(c.Names) > 0 {
+			dc.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		for _, v := range strings.Split(c.Labels[LabelVolumes], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				dc.Volumes = append(dc.Volumes, v)
+			}
+		}
+		if s := strings.TrimSpace(c.Labels[LabelCompression]); s != "" {
+			if dc.Compression, err = archive.ParseCompression(s); err != nil {
+				dc.Err = fmt.Errorf("invalid %s label: %w", LabelCompression, err)
+			}
+		}
+		discovered = append(discovered, dc)
+	}
+
+	sort.Slice(discovered, func(i, j int) bool { return discovered[i].Name < discovered[j].Name })
+	return discovered, nil
+}
+
+// BackupDiscovered backs up the volumes of a discovered container with BackupVolumes, or BackupAllVolumes when the
+// container does not list its volumes. The compression given by the container labels takes precedence over the
+// compression option of the manager.
+func (bm *BackupManager) BackupDiscovered(dc DiscoveredContainer, dest Destination) (*BackupReport, error) {
+	if dc.Err != nil {
+		return nil, dc.Err
+	}
+	if dc.Compression != "" {
+		labeled := *bm
+		labeled.opts.Compression = dc.Compression
+		bm = &labeled
+	}
+	if len(dc.Volumes) == 0 {
+		return bm.BackupAllVolumes(dc.Name, dest)
+	}
+	return bm.BackupVolumes(dc.Name, dc.Volumes, dest)
+}
@@ -0,0 +1,81 @@
+package dockerbackup
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// TestDiscoverContainers verifies that the labeled containers are listed and their backup labels parsed.
+func TestDiscoverContainers(t *testing.T) {
+	cli := &APIClientStub{containers: []types.Container{
+		{ID: "9b1e07", Names: []string{"/web"}, Labels: map[string]string{
+			LabelEnable:      "true",
+			LabelVolumes:     " static, uploads ,",
+			LabelCompression: "zstd",
+			LabelRetention:   "last=3,daily=7",
+		}},
+		{ID: "4f2a9c", Names: []string{"/db"}, Labels: map[string]string{LabelEnable: "true"}},
+		{ID: "77ac01", Names: []string{"/cache"}, Labels: map[string]string{LabelEnable: "true", LabelCompression: "lz4"}},
+	}}
+
+	discovered, err := DiscoverContainers(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if filter := cli.listOptions.Filters.Get("label"); !slices.Equal(filter, []string{"aerovault.enable=true"}) {
+		t.Errorf("expected containers filtered by label, got %v", filter)
+	}
+	if len(discovered) != 3 || discovered[0].Name != "cache" || discovered[1].Name != "db" || discovered[2].Name != "web" {
+		t.Fatalf("expected containers sorted by name, got %+v", discovered)
+	}
+
+	if discovered[0].Err == nil {
+		t.Errorf("expected an invalid compression label to be reported")
+	}
+	db := discovered[1]
+	if db.Err != nil || len(db.Volumes) != 0 || db.Compression != "" || db.Retention != "" {
+		t.Errorf("expected no backup settings for db, got %+v", db)
+	}
+	web := discovered[2]
+	if web.ID != "9b1e07" || !slices.Equal(web.Volumes, []string{"static", "uploads"}) {
+		t.Errorf("unexpected volumes for web %+v", web)
+	}
+	if web.Compression != archive.Zstd || web.Retention != "last=3,daily=7" {
+		t.Errorf("unexpected settings for web %+v", web)
+	}
+}
+
+// TestBackupDiscovered verifies that a discovered container is backed up with the volumes and compression given
+// by its labels.
+func TestBackupDiscovered(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	bm := NewBackupManager(&APIClientStub{tarContent: "archive"}, context.Background())
+	dest := newDestinationStub()
+
+	report, err := bm.BackupDiscovered(DiscoveredContainer{Name: "app", Volumes: []string{"db"}, Compression: archive.Gzip}, dest)
+	if err != nil || report.Err() != nil {
+		t.Fatalf("expected no error, got %v, %v", err, report.Err())
+	}
+	if len(report.Volumes) != 1 || report.Volumes[0].Result.Archive != "db-1609459200.tar.gz" {
+		t.Errorf("expected a gzip archive of db, got %+v", report.Volumes)
+	}
+
+	report, err = bm.BackupDiscovered(DiscoveredContainer{Name: "app"}, dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(report.Volumes) != 2 || report.Volumes[0].Result.Archive != "db-1609459200.tar" {
+		t.Errorf("expected uncompressed archives of every volume, got %+v", report.Volumes)
+	}
+
+	if _, err := bm.BackupDiscovered(DiscoveredContainer{Name: "app", Err: context.Canceled}, dest); err == nil {
+		t.Errorf("expected the label error to be returned, got nil")
+	}
+}
@@ -0,0 +1,219 @@
+package dockerbackup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// LabelPreExec is the container label holding a command run in the container before its volumes are backed up.
+	LabelPreExec = "aerovault.pre-exec"
+
+	// LabelPostExec is the container label holding a command run in the container after its volumes are backed up.
+	LabelPostExec = "aerovault.post-exec"
+
+	// hookOutputLimit is the number of bytes of output kept for each hook.
+	hookOutputLimit = 64 << 10
+
+	// execPollInterval is the interval at which a finished hook is inspected until its exit code is known.
+	execPollInterval = 100 * time.Millisecond
+)
+
+// HookPhase tells whether a hook runs before or after the backup.
+type HookPhase string
+
+const (
+	// HookPre hooks run before the backup, a failing pre hook aborts it.
+	HookPre HookPhase = "pre"
+
+	// HookPost hooks run after the backup, whether it succeeded or not.
+	HookPost HookPhase = "post"
+)
+
+// Hooks are shell commands run inside the container whose volumes are backed up, such as a database dump before the
+// backup and its removal afterwards.
+type Hooks struct {
+	Pre  []string
+	Post []string
+}
+
+// IsZero reports whether no hook is configured.
+func (h Hooks) IsZero() bool {
+	return len(h.Pre) == 0 && len(h.Post) == 0
+}
+
+// HookResult records the outcome of a hook that ran in the container. Output holds the combined standard output
+// and error of the command, truncated to its first 64 KiB.
+type HookResult struct {
+	Phase     HookPhase `json:"phase"`
+	Command   string    `json:"command"`
+	ExitCode  int       `json:"exit_code"`
+	Output    string    `json:"output,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// HookError is returned when a hook exits with a non-zero exit code.
+type HookError struct {
+	Container string
+	Result    HookResult
+}
+
+// Error returns a description of the failed hook including its exit code and output.
+func (e *HookError) Error() string {
+	msg := fmt.Sprintf("%s-exec hook %q in container %s exited with code %d", e.Result.Phase, e.Result.Command, e.Container, e.Result.ExitCode)
+	if e.Result.Output != "" {
+		msg += ": " + e.Result.Output
+	}
+	return msg
+}
+
+// containerHooks returns the hooks of the named container: the hooks set in the options, or the hooks given by the
+// container labels when the options have none.
+func (bm *BackupManager) containerHooks(containerName string) (Hooks, error) {
+	if !bm.opts.Hooks.IsZero() {
+		return bm.opts.Hooks, nil
+	}
+
+	c, err := bm.cli.ContainerInspect(bm.ctx, containerName)
+	if err != nil {
+		return Hooks{}, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+	var hooks Hooks
+	if c.Config == nil {
+		return hooks, nil
+	}
+	if cmd := strings.TrimSpace(c.Config.Labels[LabelPreExec]); cmd != "" {
+		hooks.Pre = []string{cmd}
+	}
+	if cmd := strings.TrimSpace(c.Config.Labels[LabelPostExec]); cmd != "" {
+		hooks.Post = []string{cmd}
+	}
+	return hooks, nil
+}
+
+// withContainer runs backup between the pre and post hooks of the named container, with the container quiesced as
+// selected by the consistency option. The pre hooks run in order and the first failing one aborts the backup. The
+// container is resumed and every post hook runs whatever the outcome of the pre hooks and the backup, even if the
+// context is canceled. It returns the results of the hooks that ran, along with the errors joined.
+func (bm *BackupManager) withContainer(containerName string, backup func() error) ([]HookResult, error) {
+	hooks, err := bm.containerHooks(containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []HookResult
+	for _, cmd := range hooks.Pre {
+		result, hookErr := bm.runHook(bm.ctx, containerName, HookPre, cmd)
+		if result != nil {
+			results = append(results, *result)
+		}
+		if hookErr != nil {
+			err = hookErr
+			break
+		}
+	}
+
+	if err == nil {
+		var resume func() error
+		if resume, err = bm.quiesce(containerName); err == nil {
+			err = backup()
+			err = errors.Join(err, resume())
+		}
+	}
+
+	for _, cmd := range hooks.Post {
+		result, hookErr := bm.runHook(context.WithoutCancel(bm.ctx), containerName, HookPost, cmd)
+		if result != nil {
+			results = append(results, *result)
+		}
+		err = errors.Join(err, hookErr)
+	}
+	return results, err
+}
+
+// runHook runs the shell command in the named container through the Docker exec API and waits for it to exit.
+// It returns a *HookError along with the result if the command exits with a non-zero exit code, and no result if
+// the command could not be run.
+func (bm *BackupManager) runHook(ctx context.Context, containerName string, phase HookPhase, cmd string) (*HookResult, error) {
+	log := bm.logger.With("container", containerName, "phase", string(phase), "command", cmd)
+	log.Info("running hook")
+	exec, err := bm.cli.ContainerExecCreate(ctx, containerName, container.ExecOptions{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          []string{"sh", "-c", cmd},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s-exec hook %q: %w", phase, cmd, err)
+	}
+
+	result := &HookResult{Phase: phase, Command: cmd, StartTime: nowFunc()}
+	resp, err := bm.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s-exec hook %q: %w", phase, cmd, err)
+	}
+	defer resp.Close()
+
+	output := &limitedBuffer{limit: hookOutputLimit}
+	if _, err := stdcopy.StdCopy(output, output, resp.Reader); err != nil {
+		return nil, fmt.Errorf("failed to read output of %s-exec hook %q: %w", phase, cmd, err)
+	}
+	result.Output = output.String()
+
+	for {
+		inspect, err := bm.cli.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s-exec hook %q: %w", phase, cmd, err)
+		}
+		if !inspect.Running {
+			result.ExitCode = inspect.ExitCode
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(execPollInterval):
+		}
+	}
+	result.EndTime = nowFunc()
+	log.Info("hook finished", "exit_code", result.ExitCode, "duration", result.EndTime.Sub(result.StartTime))
+
+	if result.ExitCode != 0 {
+		return result, &HookError{Container: containerName, Result: *result}
+	}
+	return result, nil
+}
+
+// limitedBuffer is a buffer that keeps the first limit bytes written to it and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write keeps as much of p as the limit allows and always reports p as written.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// String returns the kept output without surrounding whitespace, marked when it was truncated.
+func (b *limitedBuffer) String() string {
+	s := strings.TrimSpace(b.buf.String())
+	if b.truncated {
+		s += "\n[output truncated]"
+	}
+	return s
+}
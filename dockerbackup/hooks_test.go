@@ -0,0 +1,152 @@
+package dockerbackup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBackupVolume_hooks verifies that the pre hooks run before the container is paused, the post hooks after it
+// is resumed, and that their output is recorded in the result.
+func TestBackupVolume_hooks(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{tarContent: "archive", execOutput: "dump written\n"}
+	opts := BackupOptions{
+		Consistency: ConsistencyPause,
+		Hooks:       Hooks{Pre: []string{"pg_dump -f /data/dump.sql"}, Post: []string{"rm /data/dump.sql"}},
+	}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), opts)
+
+	dest := newDestinationStub()
+	result, err := bm.BackupVolume("nginx", "nginx", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	expected := []string{"exec pg_dump -f /data/dump.sql", "pause nginx", "unpause nginx", "exec rm /data/dump.sql"}
+	if !slices.Equal(cli.lifecycle, expected) {
+		t.Errorf("expected lifecycle %v, got %v", expected, cli.lifecycle)
+	}
+	if len(result.Hooks) != 2 {
+		t.Fatalf("expected 2 hook results, got %+v", result.Hooks)
+	}
+	pre := result.Hooks[0]
+	if pre.Phase != HookPre || pre.Command != "pg_dump -f /data/dump.sql" || pre.ExitCode != 0 || pre.Output != "dump written" {
+		t.Errorf("unexpected pre hook result %+v", pre)
+	}
+	if result.Hooks[1].Phase != HookPost {
+		t.Errorf("expected a post hook result, got %+v", result.Hooks[1])
+	}
+}
+
+// TestBackupVolume_labelHooks verifies that the hooks given by the container labels run when no hooks are set in
+// the options.
+func TestBackupVolume_labelHooks(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{
+		tarContent: "archive",
+		labels:     map[string]string{LabelPreExec: "redis-cli BGSAVE", LabelPostExec: " "},
+	}
+	bm := NewBackupManager(cli, context.Background())
+
+	result, err := bm.BackupVolume("nginx", "nginx", newDestinationStub())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !slices.Equal(cli.execs, []string{"redis-cli BGSAVE"}) {
+		t.Errorf("expected the labeled pre hook only, got %v", cli.execs)
+	}
+	if len(result.Hooks) != 1 {
+		t.Errorf("expected 1 hook result, got %+v", result.Hooks)
+	}
+}
+
+// TestBackupVolume_preHookFailed verifies that a failing pre hook aborts the backup and that the post hooks still
+// run.
+func TestBackupVolume_preHookFailed(t *testing.T) {
+	cli := &APIClientStub{
+		tarContent:    "archive",
+		execOutput:    "pg_dump: connection refused",
+		execExitCodes: map[string]int{"pg_dump": 2},
+	}
+	opts := BackupOptions{Consistency: ConsistencyStop, Hooks: Hooks{Pre: []string{"pg_dump", "never run"}, Post: []string{"cleanup"}}}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), opts)
+
+	dest := newDestinationStub()
+	_, err := bm.BackupVolume("nginx", "nginx", dest)
+
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("expected HookError, got %v", err)
+	}
+	if hookErr.Result.ExitCode != 2 || hookErr.Result.Output != "pg_dump: connection refused" {
+		t.Errorf("unexpected hook error %+v", hookErr.Result)
+	}
+	if !strings.Contains(err.Error(), "exited with code 2") {
+		t.Errorf("expected the exit code in the error, got %s", err)
+	}
+	if expected := []string{"exec pg_dump", "exec cleanup"}; !slices.Equal(cli.lifecycle, expected) {
+		t.Errorf("expected lifecycle %v, got %v", expected, cli.lifecycle)
+	}
+	if len(dest.objects) != 0 {
+		t.Errorf("expected nothing to be stored, got %d objects", len(dest.objects))
+	}
+}
+
+// TestBackupVolume_postHookAfterFailure verifies that the post hooks run when the backup fails, and that a failing
+// post hook is reported.
+func TestBackupVolume_postHookAfterFailure(t *testing.T) {
+	cli := &APIClientStub{exitCode: 1, execExitCodes: map[string]int{"cleanup": 1}}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Hooks: Hooks{Post: []string{"cleanup"}}})
+
+	_, err := bm.BackupVolume("nginx", "nginx", newDestinationStub())
+
+	var exitErr *ContainerExitError
+	var hookErr *HookError
+	if !errors.As(err, &exitErr) || !errors.As(err, &hookErr) {
+		t.Fatalf("expected both the backup and the hook errors, got %v", err)
+	}
+	if !slices.Equal(cli.execs, []string{"cleanup"}) {
+		t.Errorf("expected the post hook to run, got %v", cli.execs)
+	}
+}
+
+// TestBackupVolumes_hooks verifies that the hooks run once around the backup of all the volumes.
+func TestBackupVolumes_hooks(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{tarContent: "archive"}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Hooks: Hooks{Pre: []string{"sync"}, Post: []string{"true"}}})
+
+	report, err := bm.BackupAllVolumes("app", newDestinationStub())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !slices.Equal(cli.execs, []string{"sync", "true"}) {
+		t.Errorf("expected each hook to run once, got %v", cli.execs)
+	}
+	if len(report.Hooks) != 2 || len(report.Volumes) != 2 {
+		t.Errorf("expected 2 hooks and 2 volumes in the report, got %+v", report)
+	}
+}
+
+// TestLimitedBuffer verifies that the output of hooks is truncated to the limit.
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+	for _, s := range []string{"ab", "cdef", "gh"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("expected %d bytes written, got %d (%v)", len(s), n, err)
+		}
+	}
+	if b.String() != "abcd\n[output truncated]" {
+		t.Errorf("unexpected output %q", b.String())
+	}
+}
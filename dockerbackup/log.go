@@ -0,0 +1,26 @@
+package dockerbackup
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardLogger returns a logger dropping every event, used by the managers created without a logger.
+func discardLogger() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// discardHandler is a slog.Handler that is never enabled.
+type discardHandler struct{}
+
+// Enabled reports that no event is handled, whatever its level.
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+// Handle drops the record.
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+// WithAttrs returns the handler itself, as there is nothing to attach the attributes to.
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+// WithGroup returns the handler itself, as there is nothing to attach the group to.
+func (h discardHandler) WithGroup(string) slog.Handler { return h }
@@ -0,0 +1,193 @@
+package dockerbackup
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/madalinpopa/aerovault"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// ManifestExtension is the suffix appended to the name of an archive to name the manifest stored alongside it.
+const ManifestExtension = ".manifest.json"
+
+// ManifestVersion is the version of the manifest format written by this release.
+const ManifestVersion = 1
+
+// Manifest describes a backup archive and the volume it was taken from. It is stored as JSON alongside the archive,
+// so that backups can be inspected without downloading and opening the archives.
+type Manifest struct {
+	ManifestVersion  int                 `json:"manifest_version"`
+	AeroVersion      string              `json:"aero_version"`
+	Archive          string              `json:"archive"`
+	Container        *ManifestContainer  `json:"container,omitempty"`
+	Volume           ManifestVolume      `json:"volume"`
+	StartTime        time.Time           `json:"start_time"`
+	EndTime          time.Time           `json:"end_time"`
+	FileCount        int64               `json:"file_count"`
+	UncompressedSize int64               `json:"uncompressed_size"`
+	Size             int64               `json:"size"`
+	SHA256           string              `json:"sha256"`
+	Compression      archive.Compression `json:"compression"`
+	Encryption       *ManifestEncryption `json:"encryption,omitempty"`
+	Consistency      Consistency         `json:"consistency"`
+}
+
+// ManifestContainer identifies the container whose volume was backed up.
+type ManifestContainer struct {
+	Name  string `json:"name"`
+	ID    string `json:"id,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// ManifestVolume describes the backed up volume and where it was mounted.
+type ManifestVolume struct {
+	Name             string            `json:"name"`
+	Driver           string            `json:"driver,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	MountDestination string            `json:"mount_destination"`
+}
+
+// ManifestEncryption records how the archive was encrypted. Passphrase encryption has no recipients.
+type ManifestEncryption struct {
+	Method     string   `json:"method"`
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// ManifestName returns the name of the manifest stored alongside the named archive.
+func ManifestName(archiveName string) string {
+	return archiveName + ManifestExtension
+}
+
+// IsManifestName reports whether name is the name of a manifest rather than of an archive.
+func IsManifestName(name string) bool {
+	return strings.HasSuffix(name, ManifestExtension)
+}
+
+// ReadManifest decodes a manifest from r.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.ManifestVersion < 1 || m.ManifestVersion > ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.ManifestVersion)
+	}
+	return &m, nil
+}
+
+// newManifest returns the manifest of the archive described by result, taken from the given source.
+func (bm *BackupManager) newManifest(src backupSource, result *BackupResult, stats archiveStats) *Manifest {
+	m := &Manifest{
+		ManifestVersion: ManifestVersion,
+		AeroVersion:     aerovault.GetVersion(),
+		Archive:         result.Archive,
+		Volume: ManifestVolume{
+			Name:             src.volume,
+			MountDestination: src.destination,
+		},
+		StartTime:        result.StartTime,
+		EndTime:          result.EndTime,
+		FileCount:        stats.files,
+		UncompressedSize: stats.uncompressed,
+		Size:             stats.size,
+		SHA256:           stats.digest,
+		Compression:      result.Compression,
+		Consistency:      result.Consistency,
+	}
+	if bm.opts.Encryption != nil {
+		m.Encryption = &ManifestEncryption{
+			Method:     bm.opts.Encryption.Method(),
+			Recipients: bm.opts.Encryption.Recipients(),
+		}
+	}
+
+	if src.container != "" {
+		m.Container = &ManifestContainer{Name: src.container}
+		if c, err := bm.cli.ContainerInspect(bm.ctx, src.container); err == nil {
+			if c.ContainerJSONBase != nil {
+				m.Container.ID = c.ID
+				if name := strings.TrimPrefix(c.Name, "/"); name != "" {
+					m.Container.Name = name
+				}
+			}
+			if c.Config != nil {
+				m.Container.Image = c.Config.Image
+			}
+		}
+	}
+	if v, err := bm.cli.VolumeInspect(bm.ctx, src.volume); err == nil {
+		m.Volume.Driver = v.Driver
+		m.Volume.Labels = v.Labels
+	}
+	return m
+}
+
+// putManifest stores the manifest in dest alongside its archive.
+func (bm *BackupManager) putManifest(dest Destination, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return dest.Put(bm.ctx, ManifestName(m.Archive), bytes.NewReader(append(data, '\n')))
+}
+
+// archiveStats describes an archive stored by putArchive.
+type archiveStats struct {
+	// size and digest are the size and SHA-256 digest of the stored archive.
+	size   int64
+	digest string
+
+	// files and uncompressed are the number of regular files in the tar stream and its size before compression.
+	files        int64
+	uncompressed int64
+}
+
+// tarCounter counts the bytes written to it and the regular files of the tar stream they form. A stream that is not
+// a valid tar stream is still counted in bytes, with the files found up to the first invalid header.
+type tarCounter struct {
+	pw    *io.PipeWriter
+	done  chan struct{}
+	n     int64
+	files int64
+}
+
+// newTarCounter returns a tarCounter parsing the written stream in a separate goroutine. It must be closed.
+func newTarCounter() *tarCounter {
+	pr, pw := io.Pipe()
+	tc := &tarCounter{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(tc.done)
+		tr := tar.NewReader(pr)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			if hdr.FileInfo().Mode().IsRegular() {
+				tc.files++
+			}
+		}
+		// Keep reading past the end of the tar stream, or past an invalid header, so that writes never block.
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return tc
+}
+
+// Write counts p and passes it to the tar parser.
+func (tc *tarCounter) Write(p []byte) (int, error) {
+	tc.n += int64(len(p))
+	return tc.pw.Write(p)
+}
+
+// Close ends the stream and waits for the tar parser to finish. The counts are final once Close returns.
+func (tc *tarCounter) Close() error {
+	err := tc.pw.Close()
+	<-tc.done
+	return err
+}
@@ -0,0 +1,125 @@
+package dockerbackup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// TestBackupVolume_manifest verifies that a manifest describing the archive, the container and the volume is stored
+// alongside the archive.
+func TestBackupVolume_manifest(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{volumeFiles: map[string]string{"index.html": "hello", "404.html": "not found"}}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), BackupOptions{Compression: archive.Gzip, Stream: true})
+
+	dest := newDestinationStub()
+	result, err := bm.BackupVolume("nginx", "nginx", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if result.Manifest != "stub://nginx-1609459200.tar.gz.manifest.json" {
+		t.Errorf("expected manifest stub://nginx-1609459200.tar.gz.manifest.json, got %s", result.Manifest)
+	}
+
+	data, ok := dest.objects["nginx-1609459200.tar.gz.manifest.json"]
+	if !ok {
+		t.Fatalf("expected manifest to be stored, got objects %v", dest.objects)
+	}
+	m, err := ReadManifest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %s", err)
+	}
+
+	if m.AeroVersion != aerovault.GetVersion() || m.Archive != result.Archive {
+		t.Errorf("unexpected manifest header %+v", m)
+	}
+	if m.Container == nil || m.Container.Name != "nginx" || m.Container.ID != "4f2a9c" || m.Container.Image != "nginx:1.27" {
+		t.Errorf("unexpected manifest container %+v", m.Container)
+	}
+	if m.Volume.Name != "nginx" || m.Volume.MountDestination != "/var/www/data" {
+		t.Errorf("unexpected manifest volume %+v", m.Volume)
+	}
+	if m.FileCount != 2 || result.FileCount != 2 {
+		t.Errorf("expected 2 files, got %d in manifest and %d in result", m.FileCount, result.FileCount)
+	}
+	if m.UncompressedSize == 0 || m.UncompressedSize != result.UncompressedSize {
+		t.Errorf("expected uncompressed size %d, got %d", result.UncompressedSize, m.UncompressedSize)
+	}
+	if m.Size != result.Size || m.SHA256 != result.SHA256 || m.Compression != archive.Gzip {
+		t.Errorf("manifest does not match the stored archive: %+v", m)
+	}
+	if m.Encryption != nil {
+		t.Errorf("expected no encryption, got %+v", m.Encryption)
+	}
+}
+
+// TestBackupNamedVolume_manifest verifies that the manifest of a named volume backup records the volume driver and
+// labels, the encryption recipients, and no container.
+func TestBackupNamedVolume_manifest(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	identity, _ := age.GenerateX25519Identity()
+	recipient := identity.Recipient().String()
+	encryption, err := archive.NewRecipientEncryption([]string{recipient})
+	if err != nil {
+		t.Fatalf("failed to create encryption: %s", err)
+	}
+
+	dest := newDestinationStub()
+	bm := NewBackupManagerWithOptions(&APIClientStub{tarContent: "archive"}, context.Background(), BackupOptions{Encryption: encryption})
+	if _, err := bm.BackupNamedVolume("data", dest); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	m, err := ReadManifest(bytes.NewReader(dest.objects["data-1609459200.tar.age.manifest.json"]))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %s", err)
+	}
+	if m.Container != nil {
+		t.Errorf("expected no container, got %+v", m.Container)
+	}
+	if m.Volume.Driver != "local" || m.Volume.Labels["app"] != "web" {
+		t.Errorf("unexpected manifest volume %+v", m.Volume)
+	}
+	if m.Encryption == nil || m.Encryption.Method != archive.MethodX25519 || len(m.Encryption.Recipients) != 1 || m.Encryption.Recipients[0] != recipient {
+		t.Errorf("unexpected manifest encryption %+v", m.Encryption)
+	}
+	// The staged archive is not a valid tar stream, so only its size is known.
+	if m.FileCount != 0 || m.UncompressedSize != int64(len("archive")) {
+		t.Errorf("expected 0 files and 7 bytes, got %d files and %d bytes", m.FileCount, m.UncompressedSize)
+	}
+}
+
+// TestBackupVolume_manifestRejected verifies that a backup whose manifest cannot be stored fails.
+func TestBackupVolume_manifestRejected(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	dest := newDestinationStub()
+	dest.rejected = []string{"nginx-1609459200.tar.manifest.json"}
+
+	bm := NewBackupManager(&APIClientStub{tarContent: "archive"}, context.Background())
+	if _, err := bm.BackupVolume("nginx", "nginx", dest); err == nil || !strings.Contains(err.Error(), "manifest") {
+		t.Errorf("expected manifest error, got %v", err)
+	}
+}
+
+// TestReadManifest_unsupportedVersion verifies that manifests written by a newer format version are rejected.
+func TestReadManifest_unsupportedVersion(t *testing.T) {
+	if _, err := ReadManifest(strings.NewReader(`{"manifest_version": 99}`)); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if _, err := ReadManifest(strings.NewReader(`not json`)); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
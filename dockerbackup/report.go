@@ -0,0 +1,149 @@
+package dockerbackup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// BackupReport aggregates the outcome of backing up several volumes in one invocation.
+type BackupReport struct {
+	Container string         `json:"container,omitempty"`
+	Volumes   []VolumeReport `json:"volumes"`
+	Hooks     []HookResult   `json:"hooks,omitempty"`
+}
+
+// VolumeReport holds the outcome of backing up a single volume. Exactly one of Result and Err is set.
+type VolumeReport struct {
+	Volume string
+	Result *BackupResult
+	Err    error
+}
+
+// MarshalJSON encodes the volume report, replacing the error with its message.
+func (vr VolumeReport) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Volume string        `json:"volume"`
+		Result *BackupResult `json:"result,omitempty"`
+		Error  string        `json:"error,omitempty"`
+	}{Volume: vr.Volume, Result: vr.Result}
+	if vr.Err != nil {
+		out.Error = vr.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// Failed returns the reports of the volumes whose backup failed.
+func (r *BackupReport) Failed() []VolumeReport {
+	var failed []VolumeReport
+	for _, vr := range r.Volumes {
+		if vr.Err != nil {
+			failed = append(failed, vr)
+		}
+	}
+	return failed
+}
+
+// Err returns an error joining the failures of all volumes, or nil if every backup succeeded.
+func (r *BackupReport) Err() error {
+	var errs []error
+	for _, vr := range r.Failed() {
+		errs = append(errs, fmt.Errorf("volume %s: %w", vr.Volume, vr.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// BackupVolumes creates one backup per listed volume of the given container and stores them in dest. A failing
+// volume is recorded in the report and does not stop the backup of the remaining volumes. The hooks of the container
+// run once around the backup of all the volumes, during which the container is paused or stopped as selected by the
+// consistency option. An error is returned if the container cannot be inspected; if a hook fails or the container
+// cannot be quiesced or resumed, the error is returned along with the report.
+func (bm *BackupManager) BackupVolumes(containerName string, volumes []string, dest Destination) (*BackupReport, error) {
+	mounts, err := bm.getVolumeMounts(containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BackupReport{Container: containerName}
+	report.Hooks, err = bm.withContainer(containerName, func() error {
+		for _, volume := range volumes {
+			m, ok := findVolumeMount(mounts, volume)
+			if !ok {
+				report.add(volume, nil, fmt.Errorf("no mount found for volume %s", volume))
+				continue
+			}
+			result, err := bm.backup(backupSource{container: containerName, volume: volume, destination: m.Destination}, dest)
+			report.add(volume, result, err)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// BackupAllVolumes creates one backup per named volume mounted in the given container and stores them in dest.
+// Failures are reported per volume, and hooks and consistency are applied, as in BackupVolumes.
+func (bm *BackupManager) BackupAllVolumes(containerName string, dest Destination) (*BackupReport, error) {
+	mounts, err := bm.getVolumeMounts(containerName)
+	if err != nil {
+		return nil, err
+	}
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("no named volumes found for container %s", containerName)
+	}
+
+	report := &BackupReport{Container: containerName}
+	report.Hooks, err = bm.withContainer(containerName, func() error {
+		for _, m := range mounts {
+			result, err := bm.backup(backupSource{container: containerName, volume: m.Name, destination: m.Destination}, dest)
+			report.add(m.Name, result, err)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// BackupNamedVolumes creates one backup per listed named volume without requiring a container that uses them.
+// Failures are reported per volume as in BackupVolumes.
+func (bm *BackupManager) BackupNamedVolumes(volumes []string, dest Destination) *BackupReport {
+	report := &BackupReport{}
+	for _, volume := range volumes {
+		result, err := bm.BackupNamedVolume(volume, dest)
+		report.add(volume, result, err)
+	}
+	return report
+}
+
+// add records the outcome of backing up the given volume.
+func (r *BackupReport) add(volume string, result *BackupResult, err error) {
+	r.Volumes = append(r.Volumes, VolumeReport{Volume: volume, Result: result, Err: err})
+}
+
+// getVolumeMounts inspects the given container and returns its named volume mounts, ignoring bind and tmpfs mounts.
+func (bm *BackupManager) getVolumeMounts(containerName string) ([]types.MountPoint, error) {
+	bm.logger.Debug("inspecting container", "container", containerName)
+	c, err := bm.cli.ContainerInspect(bm.ctx, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", containerName, err)
+	}
+
+	var mounts []types.MountPoint
+	for _, m := range c.Mounts {
+		if m.Type == mount.TypeVolume && m.Name != "" {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts, nil
+}
+
+// findVolumeMount returns the mount of the named volume from the given mounts.
+func findVolumeMount(mounts []types.MountPoint, volumeName string) (types.MountPoint, bool) {
+	for _, m := range mounts {
+		if m.Name == volumeName {
+			return m, true
+		}
+	}
+	return types.MountPoint{}, false
+}
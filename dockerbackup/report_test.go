@@ -0,0 +1,91 @@
+package dockerbackup
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBackupAllVolumes verifies that every named volume of the container is backed up and bind mounts are ignored.
+func TestBackupAllVolumes(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	dest := newDestinationStub()
+	bm := NewBackupManager(&APIClientStub{}, context.Background())
+	report, err := bm.BackupAllVolumes("app", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if len(report.Volumes) != 2 {
+		t.Fatalf("expected 2 volume reports, got %d", len(report.Volumes))
+	}
+	if report.Volumes[0].Volume != "db" || report.Volumes[1].Volume != "cache" {
+		t.Errorf("unexpected volumes %s, %s", report.Volumes[0].Volume, report.Volumes[1].Volume)
+	}
+	if report.Err() != nil {
+		t.Errorf("expected no error, got %s", report.Err())
+	}
+	if len(dest.objects) != 4 {
+		t.Errorf("expected 2 stored archives and their manifests, got %d objects", len(dest.objects))
+	}
+	if report.Volumes[0].Result.MountDestination != "/var/lib/db" {
+		t.Errorf("expected mount destination '/var/lib/db', got %s", report.Volumes[0].Result.MountDestination)
+	}
+}
+
+// TestBackupAllVolumes_noVolumes verifies that a container without named volumes is reported as an error.
+func TestBackupAllVolumes_noVolumes(t *testing.T) {
+	bm := NewBackupManager(&APIClientStub{}, context.Background())
+	if _, err := bm.BackupAllVolumes("container", newDestinationStub()); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+// TestBackupVolumes_partialFailure verifies that a failing volume does not stop the backup of the remaining ones.
+func TestBackupVolumes_partialFailure(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	dest := newDestinationStub()
+	dest.rejected = []string{"db-1609459200.tar"}
+
+	bm := NewBackupManager(&APIClientStub{}, context.Background())
+	report, err := bm.BackupVolumes("app", []string{"missing", "db", "cache"}, dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	failed := report.Failed()
+	if len(failed) != 2 {
+		t.Fatalf("expected 2 failed volumes, got %d", len(failed))
+	}
+	if failed[0].Volume != "missing" || failed[1].Volume != "db" {
+		t.Errorf("unexpected failed volumes %s, %s", failed[0].Volume, failed[1].Volume)
+	}
+	if report.Volumes[2].Result == nil {
+		t.Errorf("expected cache volume to be backed up")
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "volume missing") {
+		t.Errorf("expected joined error mentioning the missing volume, got %v", err)
+	}
+}
+
+// TestVolumeReport_MarshalJSON verifies that errors are encoded as messages.
+func TestVolumeReport_MarshalJSON(t *testing.T) {
+	report := &BackupReport{}
+	report.add("missing", nil, os.ErrNotExist)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	expected := `{"volumes":[{"volume":"missing","error":"file does not exist"}]}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
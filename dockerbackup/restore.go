@@ -0,0 +1,198 @@
+package dockerbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/docker/docker/api/types/container"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+const (
+	restoreDir             = "/restore"
+	restoreTmpPattern      = "aero-restore-*.tar"
+	untarCmdTmpl           = "tar xvf %s/%s -C %s"
+	emptyCheckCmdTmpl      = `[ -z "$(ls -A %s)" ] || exit %d`
+	volumeNotEmptyExitCode = 3
+)
+
+// ErrVolumeNotEmpty is returned when a restore targets a volume that already contains data and force is not set.
+var ErrVolumeNotEmpty = errors.New("volume is not empty, use force to overwrite")
+
+// RestoreManager handles restore operations that extract backup archives into container volumes.
+type RestoreManager struct {
+	cli    APIClient
+	ctx    context.Context
+	opts   RestoreOptions
+	logger *slog.Logger
+}
+
+// RestoreOptions configures how a RestoreManager transfers archives into volumes.
+type RestoreOptions struct {
+	// Identities decrypt encrypted archives. Restoring an encrypted archive without identities fails with
+	// archive.ErrMissingIdentity.
+	Identities []age.Identity
+
+	// Stream copies the archive into the helper container through the Docker API instead of bind mounting it.
+	// This is required when the Docker daemon runs on another host.
+	Stream bool
+
+	// Logger receives an event for every step of the restores at the debug level. Nil discards them.
+	Logger *slog.Logger
+}
+
+// NewRestoreManager initializes and returns a new RestoreManager with the provided APIClient and context.
+func NewRestoreManager(cli APIClient, ctx context.Context) *RestoreManager {
+	return NewRestoreManagerWithOptions(cli, ctx, RestoreOptions{})
+}
+
+// NewRestoreManagerWithOptions initializes and returns a new RestoreManager that restores archives according to opts.
+func NewRestoreManagerWithOptions(cli APIClient, ctx context.Context, opts RestoreOptions) *RestoreManager {
+	logger := opts.Logger
+	if logger == nil {
+		logger = discardLogger()
+	}
+	return &RestoreManager{cli: cli, ctx: ctx, opts: opts, logger: logger}
+}
+
+// RestoreVolume extracts the archive found at archivePath into the specified volume of the given container.
+// Encrypted and compressed archives are detected from their magic bytes, and decrypted and decompressed before
+// extraction. The content of the archive is extracted into the mount destination of the volume in the container,
+// whatever the mount destination recorded in the archive.
+// The restore is refused with ErrVolumeNotEmpty when the volume already contains data, unless force is true.
+func (rm *RestoreManager) RestoreVolume(container, volume, archivePath string, force bool) error {
+	m, err := findMountPoint(rm.ctx, rm.cli, container, volume)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	return rm.restore(container, volume, m.Destination, f, force)
+}
+
+// RestoreArchive extracts the archive read from r into the specified volume of the given container. It behaves like
+// RestoreVolume for archives that are not available as local files, such as archives read from a storage backend.
+func (rm *RestoreManager) RestoreArchive(container, volume string, r io.Reader, force bool) error {
+	m, err := findMountPoint(rm.ctx, rm.cli, container, volume)
+	if err != nil {
+		return err
+	}
+	return rm.restore(container, volume, m.Destination, r, force)
+}
+
+// restore extracts the archive read from ar into the volume mounted at destinationPath. Unless streaming is enabled,
+// the archive is first written to a temporary file to be bind mounted.
+func (rm *RestoreManager) restore(container, volume, destinationPath string, ar io.Reader, force bool) error {
+	r, err := rm.openArchive(ar)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if rm.opts.Stream {
+		return rm.streamRestore(container, volume, destinationPath, r, force)
+	}
+
+	tarPath, cleanup, err := writeTempTar(r)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return rm.createRestoreContainer(container, volume, destinationPath, tarPath, force)
+}
+
+// openArchive returns a reader producing the tar stream of the archive read from r, decrypting it with the
+// configured identities and decompressing it as needed.
+func (rm *RestoreManager) openArchive(r io.Reader) (io.ReadCloser, error) {
+	dr, _, err := archive.Decrypt(r, rm.opts.Identities)
+	if err != nil {
+		return nil, err
+	}
+	tr, _, err := archive.NewReader(dr)
+	if err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// writeTempTar writes the tar stream read from r to a temporary file, with the entries made relative to the root
+// directory of the archive, and returns its path along with a cleanup function removing it.
+func writeTempTar(r io.Reader) (string, func(), error) {
+	tmp, err := os.CreateTemp("", restoreTmpPattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary archive: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(tmp.Name()) }
+
+	err = stripTarRoot(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temporary archive: %w", err)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// createRestoreContainer runs a helper container that shares the volumes of volumeFrom and extracts the archive into
+// destinationPath. The archive is bind mounted read-only into the helper container.
+func (rm *RestoreManager) createRestoreContainer(volumeFrom, volumeName, destinationPath, archivePath string, force bool) error {
+	archiveName := filepath.Base(archivePath)
+	cmd := generateUntarCommand(archiveName, destinationPath, force)
+
+	// The helper runs as root so that the ownership recorded in the archive is preserved.
+	config := &container.Config{
+		Image: image,
+		Tty:   false,
+		Cmd:   []string{"sh", "-c", cmd},
+	}
+
+	hostConfig := &container.HostConfig{
+		VolumesFrom: []string{volumeFrom},
+		Binds:       []string{fmt.Sprintf("%s:%s/%s:ro", archivePath, restoreDir, archiveName)},
+	}
+
+	log := rm.logger.With("container", volumeFrom, "volume", volumeName)
+	err := runHelperContainer(rm.ctx, rm.cli, log, config, hostConfig, helperName("restore", volumeName))
+
+	var exitErr *ContainerExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode == volumeNotEmptyExitCode {
+		return fmt.Errorf("failed to restore volume %s: %w", volumeName, ErrVolumeNotEmpty)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore volume %s: %w", volumeName, err)
+	}
+	return nil
+}
+
+// generateUntarCommand generates the shell command that extracts the named archive into the volume mounted at
+// destinationPath. Unless force is true, the command first checks that the destination is empty.
+func generateUntarCommand(archiveName, destinationPath string, force bool) string {
+	destination := shellQuote(destinationPath)
+	untar := fmt.Sprintf(untarCmdTmpl, restoreDir, archiveName, destination)
+	if force {
+		return untar
+	}
+	check := fmt.Sprintf(emptyCheckCmdTmpl, destination, volumeNotEmptyExitCode)
+	return check + " && " + untar
+}
+
+// shellQuote returns s quoted as a single word for sh, so that spaces and shell metacharacters in s are taken
+// literally.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,296 @@
+package dockerbackup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// writeCompressed writes the data read from r to a new file at path, compressed with c.
+func writeCompressed(path string, r io.Reader, c archive.Compression) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := archive.NewWriter(f, c)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// testTarball returns a tar stream holding the root directory and an index.html file in it, laid out like the
+// archives of a volume mounted at "/" + root.
+func testTarball(t *testing.T, root string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: root + "/", Mode: 0o755}); err != nil {
+		t.Fatalf("failed to write tar header: %s", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: root + "/index.html", Mode: 0o644, Size: 5}); err != nil {
+		t.Fatalf("failed to write tar header: %s", err)
+	}
+	if _, err := tw.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write tar entry: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestArchive writes a small archive of a volume mounted at /var/www/data, compressed with c, into a temporary
+// directory and returns its path.
+func writeTestArchive(t *testing.T, c archive.Compression) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nginx-1609459200.tar"+c.Extension())
+	if err := writeCompressed(path, bytes.NewReader(testTarball(t, "var/www/data")), c); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+	return path
+}
+
+// TestNewRestoreManager tests the creation of a new RestoreManager instance with a stubbed APIClient.
+func TestNewRestoreManager(t *testing.T) {
+	rm := NewRestoreManager(&APIClientStub{}, context.Background())
+	if rm == nil {
+		t.Errorf("expected RestoreManager instance, got nil")
+	}
+}
+
+// TestRestoreVolume_noVolumeFound verifies that restoring into an unknown volume fails before any container is created.
+func TestRestoreVolume_noVolumeFound(t *testing.T) {
+	cli := &APIClientStub{}
+	rm := NewRestoreManager(cli, context.Background())
+
+	err := rm.RestoreVolume("nginx", "volume", writeTestArchive(t, archive.None), false)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if cli.config != nil {
+		t.Errorf("expected no helper container to be created")
+	}
+}
+
+// TestRestoreVolume_success verifies the helper container configuration used to restore a volume.
+func TestRestoreVolume_success(t *testing.T) {
+	cli := &APIClientStub{}
+	rm := NewRestoreManager(cli, context.Background())
+
+	archivePath := writeTestArchive(t, archive.None)
+	err := rm.RestoreVolume("nginx", "nginx", archivePath, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if len(cli.hostConfig.Binds) != 1 {
+		t.Fatalf("expected a single bind, got %v", cli.hostConfig.Binds)
+	}
+	tarPath, _, _ := strings.Cut(cli.hostConfig.Binds[0], ":")
+	expectedBind := tarPath + ":/restore/" + filepath.Base(tarPath) + ":ro"
+	if tarPath == archivePath || cli.hostConfig.Binds[0] != expectedBind {
+		t.Errorf("expected a temporary copy of the archive to be bind mounted, got %v", cli.hostConfig.Binds)
+	}
+	if len(cli.hostConfig.VolumesFrom) != 1 || cli.hostConfig.VolumesFrom[0] != "nginx" {
+		t.Errorf("expected volumes from [nginx], got %v", cli.hostConfig.VolumesFrom)
+	}
+	if cmd := cli.config.Cmd[2]; !strings.Contains(cmd, "ls -A '/var/www/data'") {
+		t.Errorf("expected command to check that the volume is empty, got %s", cmd)
+	}
+}
+
+// TestRestoreVolume_otherDestination verifies that archives are extracted into the mount destination of the volume
+// in the target container when it differs from the mount destination recorded in the archive.
+func TestRestoreVolume_otherDestination(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "app-1609459200.tar")
+	if err := os.WriteFile(archivePath, testTarball(t, "srv/app/data"), 0o600); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+
+	cli := &APIClientStub{}
+	rm := NewRestoreManager(cli, context.Background())
+	if err := rm.RestoreVolume("nginx", "nginx", archivePath, false); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cmd := cli.config.Cmd[2]; !strings.HasSuffix(cmd, "-C '/var/www/data'") {
+		t.Errorf("expected archive to be extracted into /var/www/data, got %s", cmd)
+	}
+	names := readTarNames(t, bytes.NewReader(cli.restored))
+	if len(names) != 2 || names[0] != "./" || names[1] != "index.html" {
+		t.Errorf("expected entries relative to the volume root, got %v", names)
+	}
+
+	cli = &APIClientStub{}
+	rm = NewRestoreManagerWithOptions(cli, context.Background(), RestoreOptions{Stream: true})
+	if err := rm.RestoreVolume("nginx", "nginx", archivePath, false); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cli.copiedPath != "/var/www/data" {
+		t.Errorf("expected archive to be copied to /var/www/data, got %s", cli.copiedPath)
+	}
+	names = readTarNames(t, bytes.NewReader(cli.copied))
+	if len(names) != 2 || names[0] != "./" || names[1] != "index.html" {
+		t.Errorf("expected entries relative to the volume root, got %v", names)
+	}
+}
+
+// TestRestoreVolume_invalidArchive verifies that archives whose entries are not all under a single root directory
+// are refused.
+func TestRestoreVolume_invalidArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "var/www/data/", Mode: 0o755})
+	_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0o644})
+	_ = tw.Close()
+
+	archivePath := filepath.Join(t.TempDir(), "nginx-1609459200.tar")
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+
+	cli := &APIClientStub{}
+	err := NewRestoreManager(cli, context.Background()).RestoreVolume("nginx", "nginx", archivePath, true)
+	if err == nil || !strings.Contains(err.Error(), "outside of the volume directory") {
+		t.Errorf("expected entry outside of the volume directory to be refused, got %v", err)
+	}
+	if cli.config != nil {
+		t.Errorf("expected no helper container to be created")
+	}
+}
+
+// TestRestoreVolume_notEmpty verifies that a non-empty volume is reported as ErrVolumeNotEmpty.
+func TestRestoreVolume_notEmpty(t *testing.T) {
+	cli := &APIClientStub{exitCode: volumeNotEmptyExitCode}
+	rm := NewRestoreManager(cli, context.Background())
+
+	err := rm.RestoreVolume("nginx", "nginx", writeTestArchive(t, archive.None), false)
+	if !errors.Is(err, ErrVolumeNotEmpty) {
+		t.Errorf("expected ErrVolumeNotEmpty, got %v", err)
+	}
+}
+
+// TestRestoreVolume_failed verifies that an unexpected exit code of the helper container is reported as an error.
+func TestRestoreVolume_failed(t *testing.T) {
+	cli := &APIClientStub{exitCode: 2}
+	rm := NewRestoreManager(cli, context.Background())
+
+	err := rm.RestoreVolume("nginx", "nginx", writeTestArchive(t, archive.None), true)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if errors.Is(err, ErrVolumeNotEmpty) {
+		t.Errorf("expected generic error, got %v", err)
+	}
+}
+
+// TestRestoreVolume_compressed verifies that compressed archives are decompressed into a temporary tar archive that
+// is mounted into the helper container and removed after the restore.
+func TestRestoreVolume_compressed(t *testing.T) {
+	for _, c := range []archive.Compression{archive.Gzip, archive.Zstd, archive.Xz} {
+		cli := &APIClientStub{}
+		rm := NewRestoreManager(cli, context.Background())
+
+		if err := rm.RestoreVolume("nginx", "nginx", writeTestArchive(t, c), true); err != nil {
+			t.Fatalf("%s: expected no error, got %s", c, err)
+		}
+
+		tarPath, _, _ := strings.Cut(cli.hostConfig.Binds[0], ":")
+		if filepath.Dir(tarPath) != filepath.Clean(os.TempDir()) {
+			t.Errorf("%s: expected decompressed archive in %s, got %s", c, os.TempDir(), tarPath)
+		}
+		if _, err := os.Stat(tarPath); !os.IsNotExist(err) {
+			t.Errorf("%s: expected decompressed archive %s to be removed", c, tarPath)
+		}
+	}
+}
+
+// TestRestoreArchive verifies that archives read from a reader are written to a temporary tar archive that is
+// mounted into the helper container and removed after the restore.
+func TestRestoreArchive(t *testing.T) {
+	cli := &APIClientStub{}
+	rm := NewRestoreManager(cli, context.Background())
+
+	f, err := os.Open(writeTestArchive(t, archive.Gzip))
+	if err != nil {
+		t.Fatalf("failed to open archive: %s", err)
+	}
+	defer f.Close()
+
+	if err := rm.RestoreArchive("nginx", "nginx", f, false); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	tarPath, _, _ := strings.Cut(cli.hostConfig.Binds[0], ":")
+	if _, err := os.Stat(tarPath); !os.IsNotExist(err) {
+		t.Errorf("expected temporary archive %s to be removed", tarPath)
+	}
+}
+
+// TestRestoreVolume_encrypted verifies that encrypted archives are decrypted with the configured identities.
+func TestRestoreVolume_encrypted(t *testing.T) {
+	encryption, err := archive.NewPassphraseEncryption("secret")
+	if err != nil {
+		t.Fatalf("failed to create encryption: %s", err)
+	}
+	var encrypted bytes.Buffer
+	w, _ := encryption.NewWriter(&encrypted)
+	_, _ = w.Write(testTarball(t, "var/www/data"))
+	_ = w.Close()
+
+	archivePath := filepath.Join(t.TempDir(), "nginx-1609459200.tar.age")
+	if err := os.WriteFile(archivePath, encrypted.Bytes(), 0o600); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+
+	cli := &APIClientStub{}
+	err = NewRestoreManager(cli, context.Background()).RestoreVolume("nginx", "nginx", archivePath, true)
+	if !errors.Is(err, archive.ErrMissingIdentity) {
+		t.Errorf("expected ErrMissingIdentity without identity, got %v", err)
+	}
+
+	identity, _ := archive.PassphraseIdentity("secret")
+	rm := NewRestoreManagerWithOptions(cli, context.Background(), RestoreOptions{Identities: []age.Identity{identity}})
+	if err := rm.RestoreVolume("nginx", "nginx", archivePath, true); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	tarPath, _, _ := strings.Cut(cli.hostConfig.Binds[0], ":")
+	if tarPath == archivePath {
+		t.Errorf("expected a decrypted copy of the archive to be mounted")
+	}
+}
+
+// TestGenerateUntarCommand tests the generateUntarCommand function with and without force.
+func TestGenerateUntarCommand(t *testing.T) {
+	expected := `[ -z "$(ls -A '/var/www/data')" ] || exit 3 && tar xvf /restore/nginx.tar -C '/var/www/data'`
+	if cmd := generateUntarCommand("nginx.tar", "/var/www/data", false); cmd != expected {
+		t.Errorf("expected command %s, got %s", expected, cmd)
+	}
+
+	expected = "tar xvf /restore/nginx.tar -C '/var/www/data'"
+	if cmd := generateUntarCommand("nginx.tar", "/var/www/data", true); cmd != expected {
+		t.Errorf("expected command %s, got %s", expected, cmd)
+	}
+
+	expected = `[ -z "$(ls -A '/srv/it'\''s $(id)')" ] || exit 3 && tar xvf /restore/nginx.tar -C '/srv/it'\''s $(id)'`
+	if cmd := generateUntarCommand("nginx.tar", "/srv/it's $(id)", false); cmd != expected {
+		t.Errorf("expected command %s, got %s", expected, cmd)
+	}
+}
@@ -0,0 +1,102 @@
+package dockerbackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ContainerExitError is returned when a helper container exits with a non-zero exit code.
+// It carries the exit code and the standard error output captured from the container.
+type ContainerExitError struct {
+	Container string
+	ExitCode  int64
+	Stderr    string
+}
+
+// Error returns a description of the failed helper container including its exit code and captured stderr.
+func (e *ContainerExitError) Error() string {
+	msg := fmt.Sprintf("helper container %s exited with code %d", e.Container, e.ExitCode)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+// helperName returns a name for a helper container performing the given operation on the volume. The name ends with a
+// random suffix, so that concurrent backups or restores of the same volume do not conflict.
+func helperName(operation, volume string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return operation + "-" + volume + "-" + hex.EncodeToString(suffix)
+}
+
+// runHelperContainer creates and starts a helper container with the given configuration and blocks until it exits.
+// A non-zero exit code is reported as a *ContainerExitError. The container is removed once it has finished.
+func runHelperContainer(ctx context.Context, cli APIClient, log *slog.Logger, config *container.Config, hostConfig *container.HostConfig, name string) error {
+	log = log.With("helper", name)
+	log.Debug("creating helper container", "image", config.Image)
+	cr, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create helper container %s: %w", name, err)
+	}
+	defer removeHelperContainer(ctx, cli, cr.ID)
+
+	// Register the wait before starting so the exit of a short-lived container is not missed.
+	statusCh, errCh := cli.ContainerWait(ctx, cr.ID, container.WaitConditionNextExit)
+
+	log.Debug("starting helper container", "id", cr.ID)
+	if err := cli.ContainerStart(ctx, cr.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start helper container %s: %w", name, err)
+	}
+
+	log.Debug("waiting for helper container")
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to wait for helper container %s: %w", name, err)
+	case status := <-statusCh:
+		if status.Error != nil {
+			return fmt.Errorf("helper container %s failed: %s", name, status.Error.Message)
+		}
+		log.Debug("helper container exited", "exit_code", status.StatusCode)
+		if status.StatusCode != 0 {
+			return &ContainerExitError{
+				Container: name,
+				ExitCode:  status.StatusCode,
+				Stderr:    readContainerStderr(ctx, cli, cr.ID),
+			}
+		}
+		return nil
+	}
+}
+
+// readContainerStderr returns the standard error output of the given container. Failures to read the logs are
+// reported in place of the output, since they must not hide the original failure.
+func readContainerStderr(ctx context.Context, cli APIClient, containerID string) string {
+	rc, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{ShowStderr: true})
+	if err != nil {
+		return fmt.Sprintf("<failed to read container logs: %v>", err)
+	}
+	defer rc.Close()
+
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(io.Discard, &stderr, rc); err != nil {
+		return fmt.Sprintf("<failed to read container logs: %v>", err)
+	}
+	return strings.TrimSpace(stderr.String())
+}
+
+// removeHelperContainer removes the given helper container. It runs even if the context was canceled so that no
+// helper containers are left behind.
+func removeHelperContainer(ctx context.Context, cli APIClient, containerID string) {
+	ctx = context.WithoutCancel(ctx)
+	_ = cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+}
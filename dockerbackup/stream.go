@@ -0,0 +1,215 @@
+package dockerbackup
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// streamBackup archives the given source by copying the volume content out of a helper container through the Docker
+// API. The archive is compressed by aero and stored in dest under archiveName. It returns the stats of the archive.
+func (bm *BackupManager) streamBackup(log *slog.Logger, src backupSource, archiveName string, dest Destination) (archiveStats, error) {
+	config, err := createContainerConfig(image, "true")
+	if err != nil {
+		return archiveStats{}, err
+	}
+
+	name := helperName("backup", src.volume)
+	log.Debug("creating helper container", "helper", name, "image", image)
+	cr, err := bm.cli.ContainerCreate(bm.ctx, config, src.hostConfig(), nil, nil, name)
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("failed to create helper container %s: %w", name, err)
+	}
+	defer removeHelperContainer(bm.ctx, bm.cli, cr.ID)
+
+	log.Debug("copying volume from helper container", "helper", name, "path", src.destination)
+
+	rc, _, err := bm.cli.CopyFromContainer(bm.ctx, cr.ID, src.destination)
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("failed to copy volume %s from helper container: %w", src.volume, err)
+	}
+	defer rc.Close()
+
+	prefix := archivePrefix(src.destination)
+	stats, err := bm.putArchive(log, dest, archiveName, func(w io.Writer) error {
+		return rewriteTarPrefix(w, rc, prefix)
+	})
+	if err != nil {
+		return archiveStats{}, fmt.Errorf("failed to backup volume %s: %w", src.volume, err)
+	}
+	return stats, nil
+}
+
+// archivePrefix returns the prefix to add to the entries copied from the given mount destination, so that streamed
+// archives have the same layout as the ones produced by tar in the helper container.
+func archivePrefix(destinationPath string) string {
+	return strings.TrimPrefix(path.Dir(path.Clean(destinationPath)), "/")
+}
+
+// rewriteTarPrefix copies the tar stream read from src to dst, joining prefix to the name of every entry and to the
+// target of every hard link.
+func rewriteTarPrefix(dst io.Writer, src io.Reader, prefix string) error {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar stream: %w", err)
+		}
+
+		hdr.Name = joinTarName(prefix, hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = joinTarName(prefix, hdr.Linkname)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("failed to write tar entry %s: %w", hdr.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// joinTarName joins prefix to the tar entry name, keeping the trailing slash of directory entries.
+func joinTarName(prefix, name string) string {
+	joined := path.Join(prefix, name)
+	if strings.HasSuffix(name, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// stripTarRoot copies the tar stream read from src to dst, making the name of every entry and the target of every
+// hard link relative to the root directory of the archive, which is its first entry. The root directory itself is
+// written as "./", so that extracting the stream into the destination of a mount restores the volume whatever the
+// mount destination recorded in the archive.
+func stripTarRoot(dst io.Writer, src io.Reader) error {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+	root := ""
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar stream: %w", err)
+		}
+
+		if root == "" {
+			if hdr.Typeflag != tar.TypeDir {
+				return fmt.Errorf("archive does not start with the volume directory: %s", hdr.Name)
+			}
+			root = path.Clean(hdr.Name)
+		}
+		name, err := relativeTarName(root, hdr.Name)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if hdr.Typeflag == tar.TypeLink {
+			if hdr.Linkname, err = relativeTarName(root, hdr.Linkname); err != nil {
+				return err
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("failed to write tar entry %s: %w", hdr.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// relativeTarName returns the tar entry name relative to the root directory, keeping the trailing slash of directory
+// entries. The root directory itself is returned as "./".
+func relativeTarName(root, name string) (string, error) {
+	clean := path.Clean(name)
+	if clean == root {
+		return "./", nil
+	}
+	rel, ok := strings.CutPrefix(clean, root+"/")
+	if !ok {
+		return "", fmt.Errorf("archive entry %s is outside of the volume directory %s", name, root)
+	}
+	if strings.HasSuffix(name, "/") {
+		rel += "/"
+	}
+	return rel, nil
+}
+
+// stripTarRootReader returns a reader producing the tar stream read from r with the entries made relative to the
+// root directory of the archive, as done by stripTarRoot.
+func stripTarRootReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(stripTarRoot(pw, r))
+	}()
+	return pr
+}
+
+// streamRestore extracts the tar stream read from r into the volume mounted at destinationPath in a helper container
+// sharing the volumes of volumeFrom, copying the stream through the Docker API.
+func (rm *RestoreManager) streamRestore(volumeFrom, volumeName, destinationPath string, r io.Reader, force bool) error {
+	config := &container.Config{Image: image, Cmd: []string{"true"}}
+	hostConfig := &container.HostConfig{VolumesFrom: []string{volumeFrom}}
+
+	name := helperName("restore", volumeName)
+	log := rm.logger.With("container", volumeFrom, "volume", volumeName)
+	log.Debug("creating helper container", "helper", name, "image", image)
+	cr, err := rm.cli.ContainerCreate(rm.ctx, config, hostConfig, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create helper container %s: %w", name, err)
+	}
+	defer removeHelperContainer(rm.ctx, rm.cli, cr.ID)
+
+	if !force {
+		empty, err := rm.isVolumeEmpty(cr.ID, destinationPath)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return fmt.Errorf("failed to restore volume %s: %w", volumeName, ErrVolumeNotEmpty)
+		}
+	}
+
+	sr := stripTarRootReader(r)
+	defer sr.Close()
+
+	log.Debug("copying archive to helper container", "helper", name, "path", destinationPath)
+	err = rm.cli.CopyToContainer(rm.ctx, cr.ID, destinationPath, sr, container.CopyToContainerOptions{CopyUIDGID: true})
+	if err != nil {
+		return fmt.Errorf("failed to restore volume %s: %w", volumeName, err)
+	}
+	return nil
+}
+
+// isVolumeEmpty reports whether the directory at destinationPath in the given container has no entries.
+func (rm *RestoreManager) isVolumeEmpty(containerID, destinationPath string) (bool, error) {
+	rc, _, err := rm.cli.CopyFromContainer(rm.ctx, containerID, destinationPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect content of %s: %w", destinationPath, err)
+	}
+	defer rc.Close()
+
+	// The first entry is the destination directory itself, any further entry is part of its content.
+	tr := tar.NewReader(rc)
+	for i := 0; i < 2; i++ {
+		if _, err := tr.Next(); err == io.EOF {
+			return true, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to inspect content of %s: %w", destinationPath, err)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,129 @@
+package dockerbackup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/madalinpopa/aerovault/archive"
+)
+
+// readTarNames returns the entry names of the tar stream read from r.
+func readTarNames(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar stream: %s", err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+// TestBackupVolume_stream verifies that streamed backups are written locally without bind mounts and keep the
+// archive layout of tar backups.
+func TestBackupVolume_stream(t *testing.T) {
+	nowFunc = mockTimeNow
+	defer func() { nowFunc = time.Now }()
+
+	cli := &APIClientStub{volumeFiles: map[string]string{"index.html": "hello"}}
+	opts := BackupOptions{Compression: archive.Gzip, Stream: true}
+	bm := NewBackupManagerWithOptions(cli, context.Background(), opts)
+
+	dest := newDestinationStub()
+	result, err := bm.BackupVolume("nginx", "nginx", dest)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if len(cli.hostConfig.Binds) != 0 {
+		t.Errorf("expected no binds, got %v", cli.hostConfig.Binds)
+	}
+	if len(cli.removed) != 1 {
+		t.Errorf("expected helper container to be removed, got %v", cli.removed)
+	}
+	if result.ArchivePath != "stub://nginx-1609459200.tar.gz" {
+		t.Errorf("expected archive path stub://nginx-1609459200.tar.gz, got %s", result.ArchivePath)
+	}
+
+	stored := dest.objects["nginx-1609459200.tar.gz"]
+	sum := sha256.Sum256(stored)
+	if result.Size != int64(len(stored)) || result.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("result size and digest do not match the stored archive")
+	}
+
+	r, _, err := archive.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("failed to decompress archive: %s", err)
+	}
+	names := readTarNames(t, r)
+	if len(names) != 2 || names[0] != "var/www/data/" || names[1] != "var/www/data/index.html" {
+		t.Errorf("unexpected archive entries %v", names)
+	}
+}
+
+// TestRestoreVolume_stream verifies that streamed restores copy the decompressed archive into the mount destination
+// of the volume in the helper container, with the entries relative to the volume root.
+func TestRestoreVolume_stream(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "nginx.tar.xz")
+	if err := writeCompressed(archivePath, bytes.NewReader(testTarball(t, "var/www/data")), archive.Xz); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+
+	cli := &APIClientStub{}
+	rm := NewRestoreManagerWithOptions(cli, context.Background(), RestoreOptions{Stream: true})
+	if err := rm.RestoreVolume("nginx", "nginx", archivePath, false); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if cli.copiedPath != "/var/www/data" {
+		t.Errorf("expected archive to be copied to /var/www/data, got %s", cli.copiedPath)
+	}
+	names := readTarNames(t, bytes.NewReader(cli.copied))
+	if len(names) != 2 || names[0] != "./" || names[1] != "index.html" {
+		t.Errorf("unexpected copied entries %v", names)
+	}
+	if len(cli.removed) != 1 {
+		t.Errorf("expected helper container to be removed, got %v", cli.removed)
+	}
+}
+
+// TestRestoreVolume_streamNotEmpty verifies that streamed restores refuse to overwrite a volume with content.
+func TestRestoreVolume_streamNotEmpty(t *testing.T) {
+	cli := &APIClientStub{volumeFiles: map[string]string{"index.html": "hello"}}
+	rm := NewRestoreManagerWithOptions(cli, context.Background(), RestoreOptions{Stream: true})
+
+	err := rm.RestoreVolume("nginx", "nginx", writeTestArchive(t, archive.None), false)
+	if !errors.Is(err, ErrVolumeNotEmpty) {
+		t.Errorf("expected ErrVolumeNotEmpty, got %v", err)
+	}
+	if cli.copied != nil {
+		t.Errorf("expected nothing to be copied into the container")
+	}
+}
+
+// TestArchivePrefix tests the archivePrefix function.
+func TestArchivePrefix(t *testing.T) {
+	tests := map[string]string{
+		"/var/www/data":  "var/www",
+		"/var/www/data/": "var/www",
+		"/volume":        "",
+	}
+	for destination, expected := range tests {
+		if prefix := archivePrefix(destination); prefix != expected {
+			t.Errorf("expected prefix %q for %s, got %q", expected, destination, prefix)
+		}
+	}
+}
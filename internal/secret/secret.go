@@ -0,0 +1,43 @@
+// Package secret resolves references to secrets kept out of the configuration file.
+package secret
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IsReference reports whether s is written as a secret reference, such as env:NAME or file:PATH.
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, "env:") || strings.HasPrefix(s, "file:")
+}
+
+// Parse splits a secret reference into its kind, env or file, and its target.
+func Parse(ref string) (kind, target string, err error) {
+	kind, target, ok := strings.Cut(ref, ":")
+	if !ok || (kind != "env" && kind != "file") || target == "" {
+		return "", "", fmt.Errorf("invalid secret reference %q, expected env:NAME or file:PATH", ref)
+	}
+	return kind, target, nil
+}
+
+// Resolve returns the value a secret reference points to: the value of the environment variable, or the content of
+// the file without its trailing newline.
+func Resolve(ref string) (string, error) {
+	kind, target, err := Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if kind == "env" {
+		value, ok := os.LookupEnv(target)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", target)
+		}
+		return value, nil
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
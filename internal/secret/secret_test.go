@@ -0,0 +1,53 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResolve verifies that references are resolved from the environment and from files.
+func TestResolve(t *testing.T) {
+	t.Setenv("AERO_TEST_SECRET", "hunter2")
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("correct horse\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"env:AERO_TEST_SECRET", "hunter2"},
+		{"file:" + file, "correct horse"},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.ref)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %s", tt.ref, err)
+		} else if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.ref, tt.expected, got)
+		}
+	}
+}
+
+// TestResolve_invalid verifies that malformed references and missing secrets are rejected.
+func TestResolve_invalid(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"hunter2", `invalid secret reference "hunter2"`},
+		{"env:", "invalid secret reference"},
+		{"vault:secret/aws", "invalid secret reference"},
+		{"env:AERO_TEST_UNSET_SECRET", "environment variable AERO_TEST_UNSET_SECRET is not set"},
+		{"file:" + filepath.Join(t.TempDir(), "missing"), "no such file"},
+	}
+	for _, tt := range tests {
+		_, err := Resolve(tt.ref)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.ref, tt.expected, err)
+		}
+	}
+}
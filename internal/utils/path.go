@@ -16,6 +16,15 @@ const (
 
 	// errGettingOutputPathInfo is used to signal that there was an error retrieving information about the output path.
 	errGettingOutputPathInfo = "error getting output path info: %v"
+
+	// errArchivePathNotExist indicates that the specified archive path does not exist.
+	errArchivePathNotExist = "archive path does not exist"
+
+	// errArchivePathIsDir indicates that the specified archive path is a directory.
+	errArchivePathIsDir = "archive path is a directory"
+
+	// errGettingArchivePathInfo is used to signal that there was an error retrieving information about the archive path.
+	errGettingArchivePathInfo = "error getting archive path info: %v"
 )
 
 // ValidateOutputPath checks if the provided output path exists and is a directory.
@@ -38,6 +47,26 @@ func ValidateOutputPath(output string) (string, error) {
 	return absPath, nil
 }
 
+// ValidateArchivePath checks if the provided archive path exists and is a regular file.
+// It returns the absolute path if the validation is successful.
+func ValidateArchivePath(archive string) (string, error) {
+	info, err := os.Stat(archive)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New(errArchivePathNotExist)
+		}
+		return "", fmt.Errorf(errGettingArchivePathInfo, err)
+	}
+	if info.IsDir() {
+		return "", errors.New(errArchivePathIsDir)
+	}
+	absPath, err := filepath.Abs(archive)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %v", err)
+	}
+	return absPath, nil
+}
+
 // GetCurrentDir retrieves and returns the current working directory. Returns an empty string and an error if any occurs.
 func GetCurrentDir() (string, error) {
 	dir, err := os.Getwd()
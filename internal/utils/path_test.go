@@ -85,6 +85,48 @@ func TestValidateOutputPath_pathIsFile(t *testing.T) {
 	}
 }
 
+func TestValidateArchivePath_pathNotExists(t *testing.T) {
+
+	_, err := utils.ValidateArchivePath("not-exists.tar")
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+
+	if err != nil && err.Error() != "archive path does not exist" {
+		t.Errorf("expected error message: 'archive path does not exist', got: %s", err.Error())
+	}
+}
+
+func TestValidateArchivePath_pathIsDir(t *testing.T) {
+	// create a temporary directory
+	tempD := createTempD(t)
+	defer removeTempD(t, tempD)
+
+	_, err := utils.ValidateArchivePath(tempD)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	if err.Error() != "archive path is a directory" {
+		t.Errorf("expected error message: 'archive path is a directory', got: %s", err.Error())
+	}
+}
+
+func TestValidateArchivePath_pathIsFile(t *testing.T) {
+	// create a temp file
+	f := createTempFile(t)
+	defer removeTempFile(t, f.Name())
+
+	p, err := utils.ValidateArchivePath(f.Name())
+	if err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+
+	if p != f.Name() {
+		t.Errorf("expected %s, got %s", f.Name(), p)
+	}
+}
+
 func TestGetCurrenDir(t *testing.T) {
 	dir, err := utils.GetCurrentDir()
 	if err != nil {
@@ -0,0 +1,178 @@
+// Package metrics records the outcome of scheduled backup jobs as Prometheus metrics.
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all the metrics.
+const namespace = "aerovault"
+
+const (
+	statusSuccess = "success"
+	statusFailure = "failure"
+)
+
+// Metrics holds the metrics of the backup jobs, registered in a registry of their own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	jobRuns        *prometheus.CounterVec
+	jobLastSuccess *prometheus.GaugeVec
+
+	backups        *prometheus.CounterVec
+	backupDuration *prometheus.HistogramVec
+	archiveBytes   *prometheus.HistogramVec
+	lastSuccess    *prometheus.GaugeVec
+
+	pruneDeletions *prometheus.CounterVec
+	uploadDuration *prometheus.HistogramVec
+}
+
+// New returns the metrics of the backup jobs, along with the Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_runs_total",
+			Help:      "Number of runs of each backup job by status.",
+		}, []string{"job", "status"}),
+		jobLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_last_success_timestamp_seconds",
+			Help:      "Unix time of the last run of each backup job that succeeded.",
+		}, []string{"job"}),
+		backups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backups_total",
+			Help:      "Number of volume backups by status.",
+		}, []string{"job", "volume", "status"}),
+		backupDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backup_duration_seconds",
+			Help:      "Duration of the successful volume backups.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+		}, []string{"job", "volume"}),
+		archiveBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backup_archive_bytes",
+			Help:      "Size of the archives of the successful volume backups.",
+			Buckets:   prometheus.ExponentialBuckets(1<<20, 4, 11),
+		}, []string{"job", "volume"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "backup_last_success_timestamp_seconds",
+			Help:      "Unix time at which the last successful backup of each volume finished.",
+		}, []string{"job", "volume"}),
+		pruneDeletions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prune_deletions_total",
+			Help:      "Number of backups deleted by the retention policy of each job.",
+		}, []string{"job"}),
+		uploadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_upload_duration_seconds",
+			Help:      "Duration of the uploads of archives and manifests to the storage backend, by status.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 18),
+		}, []string{"job", "status"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.jobRuns, m.jobLastSuccess,
+		m.backups, m.backupDuration, m.archiveBytes, m.lastSuccess,
+		m.pruneDeletions, m.uploadDuration,
+	)
+	return m
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// InitJob creates the series of the job with zero values, so that the first failure shows up as an increase.
+func (m *Metrics) InitJob(job string) {
+	m.jobRuns.WithLabelValues(job, statusSuccess)
+	m.jobRuns.WithLabelValues(job, statusFailure)
+	m.pruneDeletions.WithLabelValues(job)
+}
+
+// ObserveJob records the outcome of a run of the job.
+func (m *Metrics) ObserveJob(job string, err error) {
+	if err != nil {
+		m.jobRuns.WithLabelValues(job, statusFailure).Inc()
+		return
+	}
+	m.jobRuns.WithLabelValues(job, statusSuccess).Inc()
+	m.jobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+}
+
+// ObserveBackups records the outcome of the volume backups of the report.
+func (m *Metrics) ObserveBackups(job string, report *dockerbackup.BackupReport) {
+	for _, vr := range report.Volumes {
+		if vr.Err != nil {
+			m.backups.WithLabelValues(job, vr.Volume, statusFailure).Inc()
+			continue
+		}
+		m.backups.WithLabelValues(job, vr.Volume, statusSuccess).Inc()
+		m.backupDuration.WithLabelValues(job, vr.Volume).Observe(vr.Result.EndTime.Sub(vr.Result.StartTime).Seconds())
+		m.archiveBytes.WithLabelValues(job, vr.Volume).Observe(float64(vr.Result.Size))
+		m.lastSuccess.WithLabelValues(job, vr.Volume).Set(float64(vr.Result.EndTime.UnixNano()) / 1e9)
+	}
+}
+
+// ObservePrune records the backups deleted by the retention policy of the job.
+func (m *Metrics) ObservePrune(job string, report *catalog.PruneReport) {
+	deleted := 0
+	for _, d := range report.Deleted() {
+		if d.Err == nil {
+			deleted++
+		}
+	}
+	m.pruneDeletions.WithLabelValues(job).Add(float64(deleted))
+}
+
+// InstrumentBackend returns b with the duration of its uploads recorded for the job.
+func (m *Metrics) InstrumentBackend(job string, b storage.Backend) storage.Backend {
+	return &instrumentedBackend{
+		Backend: b,
+		success: m.uploadDuration.WithLabelValues(job, statusSuccess),
+		failure: m.uploadDuration.WithLabelValues(job, statusFailure),
+	}
+}
+
+// instrumentedBackend is a storage backend recording the duration of its uploads.
+type instrumentedBackend struct {
+	storage.Backend
+	success prometheus.Observer
+	failure prometheus.Observer
+}
+
+// Put stores the object through the wrapped backend and records the duration of the upload.
+func (b *instrumentedBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	start := time.Now()
+	err := b.Backend.Put(ctx, name, r)
+	if err != nil {
+		b.failure.Observe(time.Since(start).Seconds())
+	} else {
+		b.success.Observe(time.Since(start).Seconds())
+	}
+	return err
+}
+
+// Close releases the resources held by the wrapped backend.
+func (b *instrumentedBackend) Close() error {
+	return storage.Close(b.Backend)
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestObserveJob verifies that the runs of a job are counted by status and that the last success is recorded.
+func TestObserveJob(t *testing.T) {
+	m := New()
+	m.InitJob("postgres")
+	if got := testutil.ToFloat64(m.jobRuns.WithLabelValues("postgres", statusFailure)); got != 0 {
+		t.Errorf("expected no failed runs, got %v", got)
+	}
+
+	m.ObserveJob("postgres", nil)
+	m.ObserveJob("postgres", errors.New("volume not found"))
+	m.ObserveJob("postgres", nil)
+
+	if got := testutil.ToFloat64(m.jobRuns.WithLabelValues("postgres", statusSuccess)); got != 2 {
+		t.Errorf("expected 2 successful runs, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.jobRuns.WithLabelValues("postgres", statusFailure)); got != 1 {
+		t.Errorf("expected 1 failed run, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.jobLastSuccess.WithLabelValues("postgres")); got < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("expected a recent last success, got %v", got)
+	}
+}
+
+// TestObserveBackups verifies that the volume backups are counted by status, and that the duration, size and time of
+// the successful ones are recorded.
+func TestObserveBackups(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	m := New()
+	m.ObserveBackups("postgres", &dockerbackup.BackupReport{Volumes: []dockerbackup.VolumeReport{
+		{Volume: "pgdata", Result: &dockerbackup.BackupResult{StartTime: start, EndTime: start.Add(90 * time.Second), Size: 4 << 20}},
+		{Volume: "pgwal", Err: errors.New("volume not found")},
+	}})
+
+	if got := testutil.ToFloat64(m.backups.WithLabelValues("postgres", "pgdata", statusSuccess)); got != 1 {
+		t.Errorf("expected 1 successful backup, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.backups.WithLabelValues("postgres", "pgwal", statusFailure)); got != 1 {
+		t.Errorf("expected 1 failed backup, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.lastSuccess.WithLabelValues("postgres", "pgdata")); got != float64(start.Add(90*time.Second).Unix()) {
+		t.Errorf("unexpected last success %v", got)
+	}
+
+	expected := `
+# HELP aerovault_backup_duration_seconds Duration of the successful volume backups.
+# TYPE aerovault_backup_duration_seconds histogram
+aerovault_backup_duration_seconds_bucket{job="postgres",volume="pgdata",le="64"} 0
+aerovault_backup_duration_seconds_bucket{job="postgres",volume="pgdata",le="128"} 1
+`
+	out := scrape(t, m)
+	for _, line := range strings.Split(strings.TrimSpace(expected), "\n") {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected metrics to contain %q", line)
+		}
+	}
+	if !strings.Contains(out, `aerovault_backup_archive_bytes_sum{job="postgres",volume="pgdata"} 4.194304e+06`) {
+		t.Errorf("expected the archive size to be recorded, got:\n%s", out)
+	}
+}
+
+// TestObservePrune verifies that only the backups actually deleted are counted.
+func TestObservePrune(t *testing.T) {
+	m := New()
+	m.ObservePrune("postgres", &catalog.PruneReport{Decisions: []catalog.PruneDecision{
+		{Keep: true},
+		{Keep: false},
+		{Keep: false, Err: errors.New("permission denied")},
+	}})
+
+	if got := testutil.ToFloat64(m.pruneDeletions.WithLabelValues("postgres")); got != 1 {
+		t.Errorf("expected 1 deletion, got %v", got)
+	}
+}
+
+// TestInstrumentBackend verifies that the uploads are timed by status and that the wrapped backend is still closed.
+func TestInstrumentBackend(t *testing.T) {
+	m := New()
+	inner := &backendStub{}
+	b := m.InstrumentBackend("postgres", inner)
+
+	if err := b.Put(context.Background(), "a.tar", strings.NewReader("archive")); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	inner.err = errors.New("connection reset")
+	if err := b.Put(context.Background(), "b.tar", strings.NewReader("archive")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if err := storage.Close(b); err != nil || !inner.closed {
+		t.Errorf("expected the wrapped backend to be closed, got %v", err)
+	}
+
+	out := scrape(t, m)
+	for _, line := range []string{
+		`aerovault_storage_upload_duration_seconds_count{job="postgres",status="success"} 1`,
+		`aerovault_storage_upload_duration_seconds_count{job="postgres",status="failure"} 1`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+}
+
+// scrape returns the metrics served by the handler.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+// backendStub is a storage backend whose uploads fail with err, and which records whether it was closed.
+type backendStub struct {
+	storage.Backend
+	err    error
+	closed bool
+}
+
+// Put reads the content of the upload to its end, then returns the configured error.
+func (b *backendStub) Put(_ context.Context, _ string, r io.Reader) error {
+	_, _ = io.Copy(io.Discard, r)
+	return b.err
+}
+
+// Close records that the backend was closed.
+func (b *backendStub) Close() error {
+	b.closed = true
+	return nil
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStub is a minimal SMTP server accepting a single message, which it records.
+type smtpStub struct {
+	ln       net.Listener
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+// newSMTPStub starts an SMTP server on a random local port, closed when the test ends.
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	s := &smtpStub{ln: ln, done: make(chan struct{})}
+	t.Cleanup(func() { _ = ln.Close() })
+	go s.serve()
+	return s
+}
+
+// serve accepts a single connection and answers its commands until QUIT, recording them along with the message
+// data. It closes done once the connection ends.
+func (s *smtpStub) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		s.commands = append(s.commands, line)
+		switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+		case "EHLO", "HELO", "MAIL", "RCPT":
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.data = strings.Join(lines, "\n")
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// TestEmail verifies that the event is sent to every recipient with a subject summarizing it.
+func TestEmail(t *testing.T) {
+	s := newSMTPStub(t)
+	m := &Email{Addr: s.ln.Addr().String(), From: "aero@example.com", To: []string{"ops@example.com", "dba@example.com"}}
+	e := NewEvent("postgres", time.Now(), time.Now(), nil, errors.New("volume not found"))
+
+	if err := m.Notify(context.Background(), e); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	<-s.done
+
+	commands := strings.Join(s.commands, "\n")
+	for _, cmd := range []string{"MAIL FROM:<aero@example.com>", "RCPT TO:<ops@example.com>", "RCPT TO:<dba@example.com>", "QUIT"} {
+		if !strings.Contains(commands, cmd) {
+			t.Errorf("expected command %q, got:\n%s", cmd, commands)
+		}
+	}
+	for _, line := range []string{"To: ops@example.com, dba@example.com", "Subject: [aero] Backup job postgres failed", "Error: volume not found"} {
+		if !strings.Contains(s.data, line) {
+			t.Errorf("expected message to contain %q, got:\n%s", line, s.data)
+		}
+	}
+}
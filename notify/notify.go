@@ -0,0 +1,291 @@
+// Package notify reports the outcome of backups through HTTP webhooks, Slack and email.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/internal/secret"
+)
+
+// Status is the outcome of a backup.
+type Status string
+
+const (
+	// StatusSuccess reports a backup of which every volume was backed up.
+	StatusSuccess Status = "success"
+
+	// StatusFailure reports a backup that failed, entirely or for some of its volumes.
+	StatusFailure Status = "failure"
+)
+
+// Event describes the outcome of a backup, or of a run of a scheduled job. Backups holds a report per container
+// whose volumes were backed up, and is empty when the backup failed before any volume was backed up.
+type Event struct {
+	Job       string                       `json:"job,omitempty"`
+	Status    Status                       `json:"status"`
+	Host      string                       `json:"host"`
+	StartTime time.Time                    `json:"start_time"`
+	EndTime   time.Time                    `json:"end_time"`
+	Error     string                       `json:"error,omitempty"`
+	Backups   []*dockerbackup.BackupReport `json:"backups"`
+}
+
+// NewEvent returns the event of a backup of the job, empty for a backup run from the command line, that ran between
+// start and end and ended with err.
+func NewEvent(job string, start, end time.Time, backups []*dockerbackup.BackupReport, err error) Event {
+	e := Event{Job: job, Status: StatusSuccess, StartTime: start, EndTime: end, Backups: backups}
+	if e.Backups == nil {
+		e.Backups = []*dockerbackup.BackupReport{}
+	}
+	e.Host, _ = os.Hostname()
+	if err != nil {
+		e.Status = StatusFailure
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Subject returns a one line summary of the event.
+func (e Event) Subject() string {
+	what := "Backup"
+	if e.Job != "" {
+		what = "Backup job " + e.Job
+	}
+	outcome := "succeeded"
+	if e.Status == StatusFailure {
+		outcome = "failed"
+	}
+	if e.Host == "" {
+		return what + " " + outcome
+	}
+	return fmt.Sprintf("%s %s on %s", what, outcome, e.Host)
+}
+
+// Details returns a plain text description of the backup, with one line per volume.
+func (e Event) Details() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Started:  %s\n", e.StartTime.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Finished: %s (%s)\n", e.EndTime.Format(time.RFC3339), e.EndTime.Sub(e.StartTime).Round(time.Second))
+	for _, report := range e.Backups {
+		for _, vr := range report.Volumes {
+			name := vr.Volume
+			if report.Container != "" {
+				name = report.Container + "/" + vr.Volume
+			}
+			if vr.Err != nil {
+				fmt.Fprintf(&b, "- %s: FAILED: %v\n", name, vr.Err)
+			} else {
+				fmt.Fprintf(&b, "- %s: %s (%d bytes)\n", name, vr.Result.ArchivePath, vr.Result.Size)
+			}
+		}
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", e.Error)
+	}
+	return b.String()
+}
+
+// Notifier delivers events to an external service.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Trigger selects the events a notifier is sent.
+type Trigger string
+
+const (
+	// OnFailure notifies failed backups only, the default.
+	OnFailure Trigger = "failure"
+
+	// OnSuccess notifies successful backups only.
+	OnSuccess Trigger = "success"
+
+	// Always notifies every backup.
+	Always Trigger = "always"
+)
+
+// Matches reports whether an event with the given status triggers the notification.
+func (t Trigger) Matches(status Status) bool {
+	switch t {
+	case Always:
+		return true
+	case OnSuccess:
+		return status == StatusSuccess
+	default:
+		return status == StatusFailure
+	}
+}
+
+// Notifier types accepted in the configuration.
+const (
+	TypeWebhook = "webhook"
+	TypeSlack   = "slack"
+	TypeEmail   = "email"
+)
+
+// defaultAttempts is the number of times a notification is attempted when the configuration does not set it.
+const defaultAttempts = 3
+
+// retryDelay is the delay before the first retry of a failed notification, doubled for every following retry.
+var retryDelay = 2 * time.Second
+
+// Config configures a notifier. URL is used by the webhook and slack types, and may be a secret reference such as
+// env:SLACK_WEBHOOK_URL since it often embeds a token. The email type sends mail through the SMTP server at
+// host:port, upgrading the connection with STARTTLS when the server offers it; Password must be a secret reference.
+type Config struct {
+	Type string `yaml:"type"`
+
+	// On is the trigger of the notification, failure when empty.
+	On Trigger `yaml:"on"`
+
+	// Attempts is the number of times delivery is attempted before giving up, 3 when zero.
+	Attempts int `yaml:"attempts"`
+
+	URL string `yaml:"url"`
+
+	SMTP     string   `yaml:"smtp"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+}
+
+// Validate checks that the configuration has the settings required by its type.
+func (c Config) Validate() error {
+	var errs []error
+	switch c.On {
+	case "", OnFailure, OnSuccess, Always:
+	default:
+		errs = append(errs, fmt.Errorf("unsupported trigger %q, expected failure, success or always", c.On))
+	}
+	if c.Attempts < 0 {
+		errs = append(errs, errors.New("attempts must not be negative"))
+	}
+
+	switch c.Type {
+	case TypeWebhook, TypeSlack:
+		if err := validateURL(c.URL); err != nil {
+			errs = append(errs, err)
+		}
+	case TypeEmail:
+		if _, _, err := net.SplitHostPort(c.SMTP); err != nil {
+			errs = append(errs, fmt.Errorf("invalid smtp address %q, expected host:port", c.SMTP))
+		}
+		if c.From == "" {
+			errs = append(errs, errors.New("from is required"))
+		}
+		if len(c.To) == 0 {
+			errs = append(errs, errors.New("to is required"))
+		}
+		if c.Password != "" {
+			if _, _, err := secret.Parse(c.Password); err != nil {
+				errs = append(errs, fmt.Errorf("password: %w", err))
+			}
+		}
+		if c.Username != "" && c.Password == "" {
+			errs = append(errs, errors.New("username requires a password"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported notifier type %q, expected webhook, slack or email", c.Type))
+	}
+	return errors.Join(errs...)
+}
+
+// validateURL checks that s is an HTTP URL or a secret reference.
+func validateURL(s string) error {
+	if s == "" {
+		return errors.New("url is required")
+	}
+	if secret.IsReference(s) {
+		_, _, err := secret.Parse(s)
+		return err
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL, or a secret reference")
+	}
+	return nil
+}
+
+// Notifier returns the notifier configured by c, with its secrets resolved.
+func (c Config) Notifier() (Notifier, error) {
+	switch c.Type {
+	case TypeWebhook, TypeSlack:
+		u := c.URL
+		if secret.IsReference(u) {
+			var err error
+			if u, err = secret.Resolve(u); err != nil {
+				return nil, fmt.Errorf("url: %w", err)
+			}
+		}
+		if c.Type == TypeSlack {
+			return &Slack{URL: u}, nil
+		}
+		return &Webhook{URL: u}, nil
+	case TypeEmail:
+		m := &Email{Addr: c.SMTP, From: c.From, To: c.To, Username: c.Username}
+		if c.Password != "" {
+			var err error
+			if m.Password, err = secret.Resolve(c.Password); err != nil {
+				return nil, fmt.Errorf("password: %w", err)
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported notifier type %q", c.Type)
+	}
+}
+
+// Dispatch sends the event through every notifier whose trigger matches its status. A failed delivery is retried
+// after a delay doubled on every attempt, up to the configured number of attempts. Returns the errors of the
+// notifications that could not be delivered, joined.
+func Dispatch(ctx context.Context, configs []Config, e Event) error {
+	var errs []error
+	for _, c := range configs {
+		if !c.On.Matches(e.Status) {
+			continue
+		}
+		if err := send(ctx, c, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s notification: %w", c.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send delivers the event through the notifier configured by c, retrying failed attempts.
+func send(ctx context.Context, c Config, e Event) error {
+	n, err := c.Notifier()
+	if err != nil {
+		return err
+	}
+	attempts := c.Attempts
+	if attempts == 0 {
+		attempts = defaultAttempts
+	}
+
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err = n.Notify(ctx, e)
+		if err == nil || attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/madalinpopa/aerovault/dockerbackup"
+)
+
+// TestNewEvent verifies that the status and error of the event follow the outcome of the backup.
+func TestNewEvent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	e := NewEvent("postgres", start, start.Add(time.Minute), nil, nil)
+	if e.Status != StatusSuccess || e.Error != "" || e.Backups == nil {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	e = NewEvent("postgres", start, start.Add(time.Minute), nil, errors.New("volume not found"))
+	if e.Status != StatusFailure || e.Error != "volume not found" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if !strings.HasPrefix(e.Subject(), "Backup job postgres failed") {
+		t.Errorf("unexpected subject %q", e.Subject())
+	}
+}
+
+// TestDetails verifies that the details of the event list every volume with its outcome.
+func TestDetails(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	e := NewEvent("postgres", start, start.Add(90*time.Second), []*dockerbackup.BackupReport{{
+		Container: "db",
+		Volumes: []dockerbackup.VolumeReport{
+			{Volume: "pgdata", Result: &dockerbackup.BackupResult{ArchivePath: "/backups/pgdata.tar.gz", Size: 1024}},
+			{Volume: "pgwal", Err: errors.New("volume not found")},
+		},
+	}}, errors.New("volume not found"))
+
+	details := e.Details()
+	for _, line := range []string{
+		"Finished: 2024-01-01T03:01:30Z (1m30s)",
+		"- db/pgdata: /backups/pgdata.tar.gz (1024 bytes)",
+		"- db/pgwal: FAILED: volume not found",
+		"Error: volume not found",
+	} {
+		if !strings.Contains(details, line) {
+			t.Errorf("expected details to contain %q, got:\n%s", line, details)
+		}
+	}
+}
+
+// TestTriggerMatches verifies which statuses each trigger notifies.
+func TestTriggerMatches(t *testing.T) {
+	tests := []struct {
+		trigger Trigger
+		success bool
+		failure bool
+	}{
+		{"", false, true},
+		{OnFailure, false, true},
+		{OnSuccess, true, false},
+		{Always, true, true},
+	}
+	for _, tt := range tests {
+		if got := tt.trigger.Matches(StatusSuccess); got != tt.success {
+			t.Errorf("%q: expected success match %v, got %v", tt.trigger, tt.success, got)
+		}
+		if got := tt.trigger.Matches(StatusFailure); got != tt.failure {
+			t.Errorf("%q: expected failure match %v, got %v", tt.trigger, tt.failure, got)
+		}
+	}
+}
+
+// TestConfigValidate verifies the settings required by each notifier type.
+func TestConfigValidate(t *testing.T) {
+	valid := []Config{
+		{Type: TypeWebhook, URL: "https://example.com/hook"},
+		{Type: TypeSlack, URL: "env:SLACK_WEBHOOK_URL", On: Always},
+		{Type: TypeEmail, SMTP: "smtp.example.com:587", From: "aero@example.com", To: []string{"ops@example.com"},
+			Username: "aero", Password: "file:/run/secrets/smtp"},
+	}
+	for _, c := range valid {
+		if err := c.Validate(); err != nil {
+			t.Errorf("%s: expected no error, got %s", c.Type, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{"type", Config{Type: "pager"}, `unsupported notifier type "pager"`},
+		{"trigger", Config{Type: TypeWebhook, URL: "https://example.com", On: "never"}, `unsupported trigger "never"`},
+		{"attempts", Config{Type: TypeWebhook, URL: "https://example.com", Attempts: -1}, "attempts must not be negative"},
+		{"missing url", Config{Type: TypeSlack}, "url is required"},
+		{"url scheme", Config{Type: TypeWebhook, URL: "ftp://example.com"}, "url must be an http or https URL"},
+		{"url reference", Config{Type: TypeWebhook, URL: "env:"}, "invalid secret reference"},
+		{"smtp", Config{Type: TypeEmail, SMTP: "smtp.example.com", From: "a@example.com", To: []string{"b@example.com"}}, "invalid smtp address"},
+		{"recipients", Config{Type: TypeEmail, SMTP: "smtp.example.com:25", From: "a@example.com"}, "to is required"},
+		{"password", Config{Type: TypeEmail, SMTP: "smtp.example.com:25", From: "a@example.com", To: []string{"b@example.com"},
+			Username: "aero", Password: "hunter2"}, "password: invalid secret reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestDispatch_trigger verifies that only the notifiers whose trigger matches the event are sent it.
+func TestDispatch_trigger(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	configs := []Config{
+		{Type: TypeWebhook, URL: srv.URL},
+		{Type: TypeWebhook, URL: srv.URL, On: OnSuccess},
+		{Type: TypeWebhook, URL: srv.URL, On: Always},
+	}
+	e := NewEvent("postgres", time.Now(), time.Now(), nil, nil)
+	if err := Dispatch(context.Background(), configs, e); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 notifications, got %d", got)
+	}
+}
+
+// TestDispatch_retry verifies that a failed delivery is retried up to the configured number of attempts.
+func TestDispatch_retry(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	e := NewEvent("postgres", time.Now(), time.Now(), nil, errors.New("volume not found"))
+	if err := Dispatch(context.Background(), []Config{{Type: TypeWebhook, URL: srv.URL}}, e); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+
+	calls.Store(0)
+	err := Dispatch(context.Background(), []Config{{Type: TypeWebhook, URL: srv.URL, Attempts: 2}}, e)
+	if err == nil || !strings.Contains(err.Error(), "webhook notification: failed after 2 attempts: webhook returned 503") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestDispatch_secretURL verifies that a URL given as a secret reference is resolved before sending.
+func TestDispatch_secretURL(t *testing.T) {
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer srv.Close()
+	t.Setenv("AERO_TEST_WEBHOOK_URL", srv.URL)
+
+	e := NewEvent("postgres", time.Now(), time.Now(), nil, errors.New("volume not found"))
+	if err := Dispatch(context.Background(), []Config{{Type: TypeSlack, URL: "env:AERO_TEST_WEBHOOK_URL"}}, e); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !called.Load() {
+		t.Error("expected the webhook to be called")
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds the time taken by a webhook request.
+const webhookTimeout = 30 * time.Second
+
+// Webhook posts events as JSON to an HTTP endpoint.
+type Webhook struct {
+	URL string
+}
+
+// Notify posts the event as JSON.
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.URL, body)
+}
+
+// Slack posts events to a Slack incoming webhook, or any service accepting the same message format.
+type Slack struct {
+	URL string
+}
+
+// Notify posts the event as a Slack message.
+func (s *Slack) Notify(ctx context.Context, e Event) error {
+	icon := ":white_check_mark:"
+	if e.Status == StatusFailure {
+		icon = ":x:"
+	}
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: fmt.Sprintf("%s *%s*\n```\n%s```", icon, e.Subject(), e.Details())})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.URL, body)
+}
+
+// post sends the JSON body to the URL and checks that the response has a 2xx status. The URL is left out of the
+// errors, as webhook URLs often embed a token.
+func post(ctx context.Context, rawURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capture starts a server recording the body of the last request it receives.
+func capture(t *testing.T) (*httptest.Server, *[]byte) {
+	t.Helper()
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &body
+}
+
+// TestWebhook verifies that the event is posted as JSON.
+func TestWebhook(t *testing.T) {
+	srv, body := capture(t)
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	e := NewEvent("postgres", start, start.Add(time.Minute), nil, errors.New("volume not found"))
+
+	if err := (&Webhook{URL: srv.URL}).Notify(context.Background(), e); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(*body, &got); err != nil {
+		t.Fatalf("expected a JSON body, got %s", err)
+	}
+	if got["job"] != "postgres" || got["status"] != "failure" || got["error"] != "volume not found" ||
+		got["start_time"] != "2024-01-01T03:00:00Z" {
+		t.Errorf("unexpected payload %v", got)
+	}
+}
+
+// TestSlack verifies that the event is posted as a Slack message.
+func TestSlack(t *testing.T) {
+	srv, body := capture(t)
+	e := NewEvent("postgres", time.Now(), time.Now(), nil, errors.New("volume not found"))
+
+	if err := (&Slack{URL: srv.URL}).Notify(context.Background(), e); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	var got struct{ Text string }
+	if err := json.Unmarshal(*body, &got); err != nil {
+		t.Fatalf("expected a JSON body, got %s", err)
+	}
+	if !strings.HasPrefix(got.Text, ":x: *Backup job postgres failed") || !strings.Contains(got.Text, "Error: volume not found") {
+		t.Errorf("unexpected message %q", got.Text)
+	}
+}
+
+// TestWebhook_hidesURL verifies that the URL, which may embed a token, is left out of the request errors.
+func TestWebhook_hidesURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	u := srv.URL + "/services/T000/B000/secret-token"
+	srv.Close()
+
+	err := (&Webhook{URL: u}).Notify(context.Background(), Event{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("expected the URL to be left out of the error, got %s", err)
+	}
+}
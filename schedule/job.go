@@ -0,0 +1,127 @@
+// Package schedule runs backup jobs on cron schedules.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/madalinpopa/aerovault/archive"
+	"github.com/madalinpopa/aerovault/catalog"
+	"github.com/madalinpopa/aerovault/dockerbackup"
+	"github.com/madalinpopa/aerovault/notify"
+	"github.com/robfig/cron/v3"
+)
+
+// Job is a backup run on a cron schedule. It backs up the volumes of a container, or named volumes directly when no
+// container is given, into the destination, and then applies the retention policy to the backups it selected.
+type Job struct {
+	Name string `yaml:"name"`
+
+	// Schedule is a standard five field cron expression, or a descriptor such as "@daily" or "@every 6h".
+	Schedule string `yaml:"schedule"`
+
+	// Container whose volumes are backed up. All its named volumes are backed up when Volumes is empty.
+	Container string   `yaml:"container"`
+	Volumes   []string `yaml:"volumes"`
+
+	// Destination is the directory or storage URL the archives are written to.
+	Destination string `yaml:"destination"`
+
+	Compression string      `yaml:"compression"`
+	Consistency string      `yaml:"consistency"`
+	Encryption  *Encryption `yaml:"encryption"`
+
+	// Retention is the policy applied after every successful backup, such as "last=3,daily=7". Nothing is pruned
+	// when it is empty.
+	Retention string `yaml:"retention"`
+
+	// Notify lists the notifiers told about the outcome of every run of the job.
+	Notify []notify.Config `yaml:"notify"`
+}
+
+// Encryption selects how archives are encrypted: to the age recipients, or with the passphrase read from a file.
+type Encryption struct {
+	Recipients     []string `yaml:"recipients"`
+	PassphraseFile string   `yaml:"passphrase_file"`
+}
+
+// Validate checks that the encryption has either recipients or a passphrase file.
+func (e *Encryption) Validate() error {
+	switch {
+	case len(e.Recipients) > 0 && e.PassphraseFile != "":
+		return errors.New("recipients and passphrase_file are mutually exclusive")
+	case len(e.Recipients) == 0 && e.PassphraseFile == "":
+		return errors.New("recipients or passphrase_file is required")
+	}
+	return nil
+}
+
+// FieldError is a problem with a field of a job, named as in the schedule.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// Error returns the description of the problem.
+func (e *FieldError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks that the job is named, selects volumes to back up, has a destination, and that its schedule,
+// compression, consistency mode, encryption, retention policy and notifiers are valid. Every problem is reported as
+// a *FieldError, joined into the returned error; problems with a notifier name it by its index, as in notify[0].
+func (j Job) Validate() error {
+	var errs []error
+	fieldErr := func(field string, err error) {
+		errs = append(errs, &FieldError{Field: field, Err: err})
+	}
+	if j.Name == "" {
+		fieldErr("name", errors.New("name is required"))
+	}
+	if _, err := cron.ParseStandard(j.Schedule); err != nil {
+		fieldErr("schedule", fmt.Errorf("invalid schedule %q: %w", j.Schedule, err))
+	}
+	if j.Container == "" && len(j.Volumes) == 0 {
+		fieldErr("volumes", errors.New("a container or volumes are required"))
+	}
+	if j.Destination == "" {
+		fieldErr("destination", errors.New("destination is required"))
+	}
+	if _, err := archive.ParseCompression(j.Compression); err != nil {
+		fieldErr("compression", err)
+	}
+	if j.Consistency != "" {
+		if _, err := dockerbackup.ParseConsistency(j.Consistency); err != nil {
+			fieldErr("consistency", err)
+		}
+		if j.Container == "" {
+			fieldErr("consistency", errors.New("consistency requires a container"))
+		}
+	}
+	if j.Encryption != nil {
+		if err := j.Encryption.Validate(); err != nil {
+			fieldErr("encryption", err)
+		}
+	}
+	if j.Retention != "" {
+		if _, err := catalog.ParsePolicy(j.Retention); err != nil {
+			fieldErr("retention", fmt.Errorf("invalid retention: %w", err))
+		}
+	}
+	for i, n := range j.Notify {
+		err := n.Validate()
+		if u, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range u.Unwrap() {
+				fieldErr(fmt.Sprintf("notify[%d]", i), err)
+			}
+		} else if err != nil {
+			fieldErr(fmt.Sprintf("notify[%d]", i), err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/notify"
+)
+
+// TestJobValidate verifies that a complete job is valid.
+func TestJobValidate(t *testing.T) {
+	job := Job{
+		Name:        "postgres",
+		Schedule:    "0 3 * * *",
+		Container:   "postgres",
+		Volumes:     []string{"pgdata"},
+		Destination: "s3://backups/postgres",
+		Compression: "zstd",
+		Consistency: "stop",
+		Encryption:  &Encryption{PassphraseFile: "/run/secrets/passphrase"},
+		Retention:   "daily=7,weekly=4",
+	}
+	if err := job.Validate(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	if err := (Job{Name: "uploads", Schedule: "@every 6h", Volumes: []string{"uploads"}, Destination: "/srv/backups"}).Validate(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+}
+
+// TestJobValidate_invalid verifies that every problem of a job is reported along with the field it concerns.
+func TestJobValidate_invalid(t *testing.T) {
+	job := Job{
+		Schedule:    "0 25 * * *",
+		Volumes:     []string{"pgdata"},
+		Compression: "lz4",
+		Consistency: "pause",
+		Encryption:  &Encryption{},
+		Retention:   "hourly=3",
+		Notify:      []notify.Config{{Type: notify.TypeSlack, URL: "https://hooks.example.com/slack"}, {Type: "pager"}},
+	}
+
+	err := job.Validate()
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	expected := map[string]string{
+		"name":        "name is required",
+		"schedule":    `invalid schedule "0 25 * * *"`,
+		"destination": "destination is required",
+		"compression": `unsupported compression "lz4"`,
+		"consistency": "consistency requires a container",
+		"encryption":  "recipients or passphrase_file is required",
+		"retention":   `unknown retention rule "hourly"`,
+		"notify[1]":   `unsupported notifier type "pager"`,
+	}
+	fields := make(map[string]bool)
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fieldErr *FieldError
+		if !errors.As(e, &fieldErr) {
+			t.Fatalf("expected FieldError, got %v", e)
+		}
+		fields[fieldErr.Field] = true
+	}
+	for field, msg := range expected {
+		if !fields[field] {
+			t.Errorf("expected an error for field %s", field)
+		}
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error to contain %q, got %s", msg, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// RunFunc runs a single backup job and returns an error if it failed.
+type RunFunc func(ctx context.Context, job Job) error
+
+// Scheduler runs jobs at the times given by their schedules. A job is never run again while a previous run of it is
+// still in progress; the overlapping run is skipped instead.
+type Scheduler struct {
+	run     RunFunc
+	logger  *slog.Logger
+	cron    *cron.Cron
+	entries []*entry
+	wg      sync.WaitGroup
+}
+
+// entry is a scheduled job along with the lock held while it runs.
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	running  sync.Mutex
+}
+
+// New returns a scheduler running the jobs with run and logging every run to logger, with the name of the job.
+// Returns an error if the schedule of a job cannot be parsed.
+func New(jobs []Job, run RunFunc, logger *slog.Logger) (*Scheduler, error) {
+	s := &Scheduler{run: run, logger: logger, cron: cron.New()}
+	for _, job := range jobs {
+		sched, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: invalid schedule %q: %w", job.Name, job.Schedule, err)
+		}
+		s.entries = append(s.entries, &entry{job: job, schedule: sched})
+	}
+	return s, nil
+}
+
+// Run starts the scheduler and blocks until ctx is canceled. Runs in progress when ctx is canceled are not
+// interrupted: Run waits for them to finish before returning.
+func (s *Scheduler) Run(ctx context.Context) {
+	// Runs must outlive ctx, so that a backup is never left half written on shutdown.
+	runCtx := context.WithoutCancel(ctx)
+	for _, e := range s.entries {
+		s.cron.Schedule(e.schedule, cron.FuncJob(func() { s.trigger(runCtx, e) }))
+	}
+
+	s.cron.Start()
+	for _, e := range s.entries {
+		s.logger.Info("job scheduled", "job", e.job.Name, "schedule", e.job.Schedule, "next_run", e.schedule.Next(time.Now()).Format(time.RFC3339))
+	}
+
+	<-ctx.Done()
+	s.logger.Info("shutting down, waiting for running jobs to finish")
+	<-s.cron.Stop().Done()
+	s.wg.Wait()
+}
+
+// trigger runs the job of the entry unless a previous run of it is still in progress, and logs the outcome.
+func (s *Scheduler) trigger(ctx context.Context, e *entry) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	log := s.logger.With("job", e.job.Name)
+	if !e.running.TryLock() {
+		log.Warn("job skipped, the previous run is still in progress")
+		return
+	}
+	defer e.running.Unlock()
+
+	log.Info("job started")
+	start := time.Now()
+	if err := s.run(ctx, e.job); err != nil {
+		log.Error("job failed", "duration", time.Since(start).Round(time.Millisecond), "error", err)
+		return
+	}
+	log.Info("job succeeded", "duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a buffer safe for concurrent use by the scheduler logger and the test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write appends p to the buffer.
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the content written so far.
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestNew_invalidSchedule verifies that a job with an invalid schedule is rejected.
+func TestNew_invalidSchedule(t *testing.T) {
+	jobs := []Job{{Name: "postgres", Schedule: "every day"}}
+	if _, err := New(jobs, nil, slog.New(slog.NewTextHandler(&syncBuffer{}, nil))); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// TestTrigger_overlap verifies that a job is skipped while a previous run of it is in progress, and that each run
+// is logged.
+func TestTrigger_overlap(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	run := func(ctx context.Context, job Job) error {
+		close(started)
+		<-release
+		return errors.New("volume not found")
+	}
+	logs := &syncBuffer{}
+	s, err := New([]Job{{Name: "postgres", Schedule: "@daily"}}, run, slog.New(slog.NewTextHandler(logs, nil)))
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.trigger(context.Background(), s.entries[0])
+		close(done)
+	}()
+	<-started
+	s.trigger(context.Background(), s.entries[0])
+	close(release)
+	<-done
+
+	out := logs.String()
+	for _, line := range []string{
+		`msg="job started" job=postgres`,
+		`level=WARN msg="job skipped, the previous run is still in progress" job=postgres`,
+		`level=ERROR msg="job failed" job=postgres duration=`,
+		`error="volume not found"`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected log to contain %q, got:\n%s", line, out)
+		}
+	}
+	if strings.Count(out, "job started") != 1 {
+		t.Errorf("expected a single run, got:\n%s", out)
+	}
+}
+
+// TestRun_waitsForRunningJobs verifies that canceling the scheduler waits for the runs in progress, which are not
+// canceled.
+func TestRun_waitsForRunningJobs(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runErr error
+	run := func(ctx context.Context, job Job) error {
+		close(started)
+		<-release
+		runErr = ctx.Err()
+		return nil
+	}
+	s, err := New([]Job{{Name: "postgres", Schedule: "@daily"}}, run, slog.New(slog.NewTextHandler(&syncBuffer{}, nil)))
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+	go s.trigger(context.WithoutCancel(ctx), s.entries[0])
+	<-started
+
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("expected Run to wait for the running job")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once the job finished")
+	}
+	if runErr != nil {
+		t.Errorf("expected the run not to be canceled, got %s", runErr)
+	}
+}
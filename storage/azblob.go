@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/docker/go-units"
+)
+
+const (
+	// defaultAzureBlockSize is the size of the blocks staged by uploads. Azure allows at most 50000 blocks per blob,
+	// which puts the largest archive at roughly 780GiB with the default.
+	defaultAzureBlockSize = 16 * units.MiB
+
+	// azureUploadConcurrency is the number of blocks staged in parallel. Each one buffers a block in memory.
+	azureUploadConcurrency = 4
+)
+
+// azblobConfig holds the settings of an Azure Blob Storage backend parsed from an azblob:// URL.
+type azblobConfig struct {
+	account   string
+	container string
+	prefix    string
+	endpoint  string
+	tier      *blob.AccessTier
+	blockSize int64
+}
+
+// parseAzblobURL parses a URL of the form azblob://account/container/prefix?endpoint=...&tier=...&block-size=...
+// The endpoint defaults to the AZURE_STORAGE_BLOB_ENDPOINT environment variable, then to the public endpoint of the
+// account. For the Azurite emulator, use an endpoint such as http://127.0.0.1:10000/devstoreaccount1.
+func parseAzblobURL(u *url.URL, getenv func(string) string) (azblobConfig, error) {
+	if u.Host == "" {
+		return azblobConfig{}, fmt.Errorf("missing account in Azure Blob URL %q", u.String())
+	}
+	containerName, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if containerName == "" {
+		return azblobConfig{}, fmt.Errorf("missing container in Azure Blob URL %q", u.String())
+	}
+
+	q := u.Query()
+	cfg := azblobConfig{
+		account:   u.Host,
+		container: containerName,
+		prefix:    prefix,
+		blockSize: defaultAzureBlockSize,
+	}
+
+	endpoint := firstNonEmpty(q.Get("endpoint"), getenv("AZURE_STORAGE_BLOB_ENDPOINT"), "https://"+cfg.account+".blob.core.windows.net")
+	cfg.endpoint = strings.TrimSuffix(endpoint, "/")
+
+	if t := q.Get("tier"); t != "" {
+		tier, err := parseAccessTier(t)
+		if err != nil {
+			return azblobConfig{}, err
+		}
+		cfg.tier = &tier
+	}
+
+	if bs := q.Get("block-size"); bs != "" {
+		size, err := units.RAMInBytes(bs)
+		if err != nil {
+			return azblobConfig{}, fmt.Errorf("invalid block-size %q: %w", bs, err)
+		}
+		if size < units.MiB || size > 4000*units.MiB {
+			return azblobConfig{}, fmt.Errorf("block-size must be between 1MiB and 4000MiB, got %s", bs)
+		}
+		cfg.blockSize = size
+	}
+	return cfg, nil
+}
+
+// parseAccessTier returns the blob access tier matching s, ignoring case.
+func parseAccessTier(s string) (blob.AccessTier, error) {
+	for _, tier := range []blob.AccessTier{blob.AccessTierHot, blob.AccessTierCool, blob.AccessTierCold, blob.AccessTierArchive} {
+		if strings.EqualFold(s, string(tier)) {
+			return tier, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported access tier %q, expected Hot, Cool, Cold or Archive", s)
+}
+
+// AzblobBackend stores objects as block blobs in an Azure Blob Storage container, below an optional name prefix.
+type AzblobBackend struct {
+	client *container.Client
+	cfg    azblobConfig
+}
+
+// openAzblobURL returns the AzblobBackend addressed by an azblob:// URL. The container is accessed with the SAS token
+// in AZURE_STORAGE_SAS_TOKEN or, failing that, with the shared key of the account in AZURE_STORAGE_KEY. Environment
+// variables are read with getenv.
+func openAzblobURL(u *url.URL, getenv func(string) string) (*AzblobBackend, error) {
+	cfg, err := parseAzblobURL(u, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	containerURL := cfg.endpoint + "/" + url.PathEscape(cfg.container)
+	var client *container.Client
+	switch {
+	case getenv("AZURE_STORAGE_SAS_TOKEN") != "":
+		sas := strings.TrimPrefix(getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+		client, err = container.NewClientWithNoCredential(containerURL+"?"+sas, nil)
+	case getenv("AZURE_STORAGE_KEY") != "":
+		var cred *container.SharedKeyCredential
+		cred, err = container.NewSharedKeyCredential(cfg.account, getenv("AZURE_STORAGE_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Azure storage key: %w", err)
+		}
+		client, err = container.NewClientWithSharedKeyCredential(containerURL, cred, nil)
+	default:
+		return nil, errors.New("missing Azure credentials, set AZURE_STORAGE_SAS_TOKEN or AZURE_STORAGE_KEY")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob client for %s: %w", containerURL, err)
+	}
+	return &AzblobBackend{client: client, cfg: cfg}, nil
+}
+
+// Put uploads the content read from r by staging it in blocks and committing the block list once the stream ends,
+// so archives of unknown size can be streamed without being buffered on disk. The configured access tier is applied
+// to the committed blob.
+func (b *AzblobBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	contentType := "application/octet-stream"
+	_, err = b.client.NewBlockBlobClient(key).UploadStream(ctx, r, &blockblob.UploadStreamOptions{
+		BlockSize:   b.cfg.blockSize,
+		Concurrency: azureUploadConcurrency,
+		AccessTier:  b.cfg.tier,
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", b.Location(name), err)
+	}
+	return nil
+}
+
+// Get returns a reader for the content of the named object.
+func (b *AzblobBackend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.NewBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, b.wrapErr(name, err)
+	}
+	return resp.Body, nil
+}
+
+// List returns the objects below the configured prefix whose name starts with prefix.
+func (b *AzblobBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	keyPrefix := prefix
+	if b.cfg.prefix != "" {
+		keyPrefix = b.cfg.prefix + "/" + prefix
+	}
+
+	var objects []ObjectInfo
+	pager := b.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &keyPrefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", b.Location(prefix), err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			info := ObjectInfo{Name: b.name(*item.Name)}
+			if p := item.Properties; p != nil {
+				if p.ContentLength != nil {
+					info.Size = *p.ContentLength
+				}
+				if p.LastModified != nil {
+					info.ModTime = *p.LastModified
+				}
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+// Delete removes the named object.
+func (b *AzblobBackend) Delete(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	if _, err := b.client.NewBlobClient(key).Delete(ctx, nil); err != nil {
+		return b.wrapErr(name, err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of the named object.
+func (b *AzblobBackend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	props, err := b.client.NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		return ObjectInfo{}, b.wrapErr(name, err)
+	}
+	info := ObjectInfo{Name: name}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.LastModified != nil {
+		info.ModTime = *props.LastModified
+	}
+	return info, nil
+}
+
+// Location returns the azblob:// URL of the named object.
+func (b *AzblobBackend) Location(name string) string {
+	return "azblob://" + path.Join(b.cfg.account, b.cfg.container, b.cfg.prefix, name)
+}
+
+// key returns the blob name of the named object, rejecting names that escape the configured prefix.
+func (b *AzblobBackend) key(name string) (string, error) {
+	clean, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(b.cfg.prefix, clean), nil
+}
+
+// name returns the object name of the given blob name, relative to the configured prefix.
+func (b *AzblobBackend) name(key string) string {
+	if b.cfg.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, b.cfg.prefix+"/")
+}
+
+// wrapErr converts Azure missing blob errors into ErrNotFound.
+func (b *AzblobBackend) wrapErr(name string, err error) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, b.Location(name))
+	}
+	return fmt.Errorf("%s: %w", b.Location(name), err)
+}
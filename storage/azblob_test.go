@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+)
+
+// TestParseAzblobURL verifies that the account, container, prefix and query parameters of an azblob:// URL are parsed.
+func TestParseAzblobURL(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_BLOB_ENDPOINT", "")
+
+	u, _ := url.Parse("azblob://devstoreaccount1/backups/hosts/web-1?endpoint=http://127.0.0.1:10000/devstoreaccount1/&tier=cool&block-size=32MiB")
+	cfg, err := parseAzblobURL(u, os.Getenv)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if cfg.account != "devstoreaccount1" || cfg.container != "backups" || cfg.prefix != "hosts/web-1" {
+		t.Errorf("expected devstoreaccount1/backups/hosts/web-1, got %s/%s/%s", cfg.account, cfg.container, cfg.prefix)
+	}
+	if cfg.endpoint != "http://127.0.0.1:10000/devstoreaccount1" {
+		t.Errorf("expected Azurite endpoint, got %s", cfg.endpoint)
+	}
+	if cfg.tier == nil || *cfg.tier != blob.AccessTierCool {
+		t.Errorf("expected tier Cool, got %v", cfg.tier)
+	}
+	if cfg.blockSize != 32<<20 {
+		t.Errorf("expected block size 32MiB, got %d", cfg.blockSize)
+	}
+}
+
+// TestParseAzblobURL_defaults verifies the public endpoint and default options of an azblob:// URL.
+func TestParseAzblobURL_defaults(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_BLOB_ENDPOINT", "")
+
+	u, _ := url.Parse("azblob://myaccount/backups")
+	cfg, err := parseAzblobURL(u, os.Getenv)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cfg.endpoint != "https://myaccount.blob.core.windows.net" {
+		t.Errorf("expected public endpoint, got %s", cfg.endpoint)
+	}
+	if cfg.prefix != "" || cfg.tier != nil || cfg.blockSize != defaultAzureBlockSize {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+}
+
+// TestParseAzblobURL_errors verifies that azblob:// URLs with a missing account or container, or invalid options, are
+// rejected.
+func TestParseAzblobURL_errors(t *testing.T) {
+	for _, rawURL := range []string{
+		"azblob:///backups",
+		"azblob://myaccount",
+		"azblob://myaccount/backups?tier=Frozen",
+		"azblob://myaccount/backups?block-size=512KiB",
+		"azblob://myaccount/backups?block-size=lots",
+	} {
+		u, _ := url.Parse(rawURL)
+		if _, err := parseAzblobURL(u, os.Getenv); err == nil {
+			t.Errorf("expected error for %s, got nil", rawURL)
+		}
+	}
+}
+
+// TestOpenAzblobURL_credentials verifies that a container is opened with a SAS token and not without credentials.
+func TestOpenAzblobURL_credentials(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_SAS_TOKEN", "")
+	t.Setenv("AZURE_STORAGE_KEY", "")
+
+	u, _ := url.Parse("azblob://myaccount/backups")
+	if _, err := openAzblobURL(u, os.Getenv); err == nil {
+		t.Error("expected error without credentials, got nil")
+	}
+
+	t.Setenv("AZURE_STORAGE_SAS_TOKEN", "?sv=2022-11-02&sig=abc")
+	b, err := openAzblobURL(u, os.Getenv)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if loc := b.Location("data-1.tar"); loc != "azblob://myaccount/backups/data-1.tar" {
+		t.Errorf("expected location azblob://myaccount/backups/data-1.tar, got %s", loc)
+	}
+}
+
+// TestAzblobBackend_keys verifies the mapping between object names and blob names below the prefix, and that names
+// escaping the prefix are rejected.
+func TestAzblobBackend_keys(t *testing.T) {
+	b := &AzblobBackend{cfg: azblobConfig{account: "myaccount", container: "backups", prefix: "hosts/web-1"}}
+
+	if key, err := b.key("data-1.tar"); err != nil || key != "hosts/web-1/data-1.tar" {
+		t.Errorf("expected key hosts/web-1/data-1.tar, got %s (%v)", key, err)
+	}
+	for _, name := range []string{"", "../web-2/data-1.tar", "/data-1.tar"} {
+		if _, err := b.key(name); err == nil {
+			t.Errorf("expected error for %q, got nil", name)
+		}
+	}
+	if loc := b.Location("data-1.tar"); loc != "azblob://myaccount/backups/hosts/web-1/data-1.tar" {
+		t.Errorf("expected location azblob://myaccount/backups/hosts/web-1/data-1.tar, got %s", loc)
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/madalinpopa/aerovault/internal/utils"
+)
+
+// tmpPrefix marks the temporary files written by FileBackend.Put before they are renamed into place.
+const tmpPrefix = ".aero-tmp-"
+
+// FileBackend stores objects as files below a root directory on the local filesystem.
+type FileBackend struct {
+	root string
+}
+
+// NewFileBackend returns a FileBackend rooted at dir, which must be an existing directory.
+// An empty dir resolves to the current working directory.
+func NewFileBackend(dir string) (*FileBackend, error) {
+	root, err := utils.GetResolvedOutputPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileBackend{root: root}, nil
+}
+
+// openFileURL returns the FileBackend addressed by a file:// URL.
+func openFileURL(u *url.URL) (*FileBackend, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("unsupported host %q in file URL, only local paths are supported", u.Host)
+	}
+	return NewFileBackend(u.Path)
+}
+
+// Put writes the content read from r to a temporary file and renames it to the named file once complete, so that
+// partially written archives never appear under their final name.
+func (b *FileBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	p, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), tmpPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to rename temporary file to %s: %w", name, err)
+	}
+	return nil
+}
+
+// Get opens the named file for reading.
+func (b *FileBackend) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	p, err := b.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, b.wrapErr(name, err)
+	}
+	return f, nil
+}
+
+// List walks the root directory and returns the files whose name starts with prefix.
+// Temporary files of uploads in progress are skipped.
+func (b *FileBackend) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(b.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tmpPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", b.root, err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+// Delete removes the named file.
+func (b *FileBackend) Delete(_ context.Context, name string) error {
+	p, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return b.wrapErr(name, err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of the named file.
+func (b *FileBackend) Stat(_ context.Context, name string) (ObjectInfo, error) {
+	p, err := b.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, b.wrapErr(name, err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory", name)
+	}
+	return ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Location returns the filesystem path of the named file.
+func (b *FileBackend) Location(name string) string {
+	return filepath.Join(b.root, filepath.FromSlash(name))
+}
+
+// path returns the filesystem path of the named object, rejecting names that escape the root directory.
+func (b *FileBackend) path(name string) (string, error) {
+	clean, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b.root, filepath.FromSlash(clean)), nil
+}
+
+// wrapErr converts filesystem not-exist errors into ErrNotFound.
+func (b *FileBackend) wrapErr(name string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
+
+// contextReader is a reader that stops with the context error once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader unless the context is done.
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,99 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// TestOpen_fileURL verifies that file:// URLs open a local backend rooted at their path.
+func TestOpen_fileURL(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := storage.Open(context.Background(), "file://"+dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if loc := b.Location("a.tar"); loc != filepath.Join(dir, "a.tar") {
+		t.Errorf("expected location %s, got %s", filepath.Join(dir, "a.tar"), loc)
+	}
+}
+
+// TestOpen_plainPath verifies that paths without a scheme open a FileBackend.
+func TestOpen_plainPath(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := storage.Open(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if _, ok := b.(*storage.FileBackend); !ok {
+		t.Errorf("expected FileBackend, got %T", b)
+	}
+}
+
+// TestOpen_errors verifies that unsupported schemes, remote file URLs and missing directories are rejected.
+func TestOpen_errors(t *testing.T) {
+	for _, rawURL := range []string{"ftp://host/path", "file://remote/srv", filepath.Join(t.TempDir(), "missing")} {
+		if _, err := storage.Open(context.Background(), rawURL); err == nil {
+			t.Errorf("expected error for %s, got nil", rawURL)
+		}
+	}
+}
+
+// TestFileBackend runs the backend tests against a local directory.
+func TestFileBackend(t *testing.T) {
+	b, err := storage.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	testBackend(t, b)
+}
+
+// TestFileBackend_putFailure verifies that a failed upload leaves neither the object nor a temporary file behind.
+func TestFileBackend_putFailure(t *testing.T) {
+	dir := t.TempDir()
+	b, err := storage.NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	failing := io.MultiReader(strings.NewReader("partial"), errReader{})
+	if err := b.Put(context.Background(), "data.tar", failing); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty directory, got %d entries", len(entries))
+	}
+}
+
+// TestFileBackend_invalidName verifies that empty, absolute and escaping object names are rejected.
+func TestFileBackend_invalidName(t *testing.T) {
+	b, err := storage.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	for _, name := range []string{"", "../escape.tar", "/abs.tar"} {
+		if err := b.Put(context.Background(), name, strings.NewReader("x")); err == nil {
+			t.Errorf("expected error for name %q, got nil", name)
+		}
+	}
+}
+
+// errReader is a reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
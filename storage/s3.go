@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	// defaultS3Endpoint is the endpoint used when neither the URL nor the environment configures one.
+	defaultS3Endpoint = "s3.amazonaws.com"
+
+	// defaultS3PartSize bounds the memory used to buffer parts of streamed multipart uploads.
+	defaultS3PartSize = 64 * units.MiB
+)
+
+// s3Config holds the settings of an S3 backend parsed from an s3:// URL.
+type s3Config struct {
+	bucket       string
+	prefix       string
+	endpoint     string
+	secure       bool
+	region       string
+	sse          string
+	kmsKeyID     string
+	storageClass string
+	partSize     uint64
+}
+
+// parseS3URL parses a URL of the form s3://bucket/prefix?endpoint=...&region=...&sse=...&storage-class=...
+// The endpoint defaults to the AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL environment variables, then to AWS S3.
+// An endpoint with an http:// scheme disables TLS, which is useful for a local MinIO server.
+func parseS3URL(u *url.URL, getenv func(string) string) (s3Config, error) {
+	if u.Host == "" {
+		return s3Config{}, fmt.Errorf("missing bucket in S3 URL %q", u.String())
+	}
+
+	q := u.Query()
+	cfg := s3Config{
+		bucket:       u.Host,
+		prefix:       strings.Trim(u.Path, "/"),
+		region:       q.Get("region"),
+		sse:          q.Get("sse"),
+		kmsKeyID:     q.Get("sse-kms-key-id"),
+		storageClass: q.Get("storage-class"),
+		partSize:     defaultS3PartSize,
+		secure:       true,
+	}
+	if cfg.region == "" {
+		cfg.region = getenv("AWS_REGION")
+	}
+
+	endpoint := firstNonEmpty(q.Get("endpoint"), getenv("AWS_ENDPOINT_URL_S3"), getenv("AWS_ENDPOINT_URL"), defaultS3Endpoint)
+	switch {
+	case strings.HasPrefix(endpoint, "http://"):
+		cfg.secure = false
+		cfg.endpoint = strings.TrimPrefix(endpoint, "http://")
+	case strings.HasPrefix(endpoint, "https://"):
+		cfg.endpoint = strings.TrimPrefix(endpoint, "https://")
+	default:
+		cfg.endpoint = endpoint
+	}
+	cfg.endpoint = strings.TrimSuffix(cfg.endpoint, "/")
+
+	switch cfg.sse {
+	case "", "AES256":
+	case "aws:kms":
+		if cfg.kmsKeyID == "" {
+			return s3Config{}, fmt.Errorf("sse=aws:kms requires sse-kms-key-id")
+		}
+	default:
+		return s3Config{}, fmt.Errorf("unsupported server-side encryption %q, expected AES256 or aws:kms", cfg.sse)
+	}
+
+	if ps := q.Get("part-size"); ps != "" {
+		size, err := units.RAMInBytes(ps)
+		if err != nil {
+			return s3Config{}, fmt.Errorf("invalid part-size %q: %w", ps, err)
+		}
+		if size < 5*units.MiB {
+			return s3Config{}, fmt.Errorf("part-size must be at least 5MiB, got %s", ps)
+		}
+		cfg.partSize = uint64(size)
+	}
+	return cfg, nil
+}
+
+// S3Backend stores objects in an S3-compatible object storage bucket, below an optional key prefix.
+type S3Backend struct {
+	client *minio.Client
+	cfg    s3Config
+}
+
+// openS3URL returns the S3Backend addressed by an s3:// URL. Credentials are read from the standard AWS environment
+// variables, the AWS shared credentials file or the instance metadata service, in that order. Environment variables
+// are read with getenv.
+func openS3URL(u *url.URL, getenv func(string) string) (*S3Backend, error) {
+	cfg, err := parseS3URL(u, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.Static{Value: credentials.Value{
+			AccessKeyID:     firstNonEmpty(getenv("AWS_ACCESS_KEY_ID"), getenv("AWS_ACCESS_KEY")),
+			SecretAccessKey: firstNonEmpty(getenv("AWS_SECRET_ACCESS_KEY"), getenv("AWS_SECRET_KEY")),
+			SessionToken:    getenv("AWS_SESSION_TOKEN"),
+			SignerType:      credentials.SignatureV4,
+		}},
+		&credentials.Static{Value: credentials.Value{
+			AccessKeyID:     firstNonEmpty(getenv("MINIO_ROOT_USER"), getenv("MINIO_ACCESS_KEY")),
+			SecretAccessKey: firstNonEmpty(getenv("MINIO_ROOT_PASSWORD"), getenv("MINIO_SECRET_KEY")),
+			SignerType:      credentials.SignatureV4,
+		}},
+		&credentials.FileAWSCredentials{Filename: getenv("AWS_SHARED_CREDENTIALS_FILE"), Profile: getenv("AWS_PROFILE")},
+		&credentials.IAM{},
+	})
+	client, err := minio.New(cfg.endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: cfg.secure,
+		Region: cfg.region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for %s: %w", cfg.endpoint, err)
+	}
+	return &S3Backend{client: client, cfg: cfg}, nil
+}
+
+// Put uploads the content read from r as a multipart upload, so archives of unknown size can be streamed without
+// being buffered on disk. Server-side encryption and storage class are applied as configured in the URL.
+func (b *S3Backend) Put(ctx context.Context, name string, r io.Reader) error {
+	opts := minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		StorageClass: b.cfg.storageClass,
+		PartSize:     b.cfg.partSize,
+	}
+	switch b.cfg.sse {
+	case "AES256":
+		opts.ServerSideEncryption = encrypt.NewSSE()
+	case "aws:kms":
+		sse, err := encrypt.NewSSEKMS(b.cfg.kmsKeyID, nil)
+		if err != nil {
+			return fmt.Errorf("invalid KMS key: %w", err)
+		}
+		opts.ServerSideEncryption = sse
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	if _, err := b.client.PutObject(ctx, b.cfg.bucket, key, r, -1, opts); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", b.Location(name), err)
+	}
+	return nil
+}
+
+// Get returns a reader for the content of the named object.
+func (b *S3Backend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := b.client.GetObject(ctx, b.cfg.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, b.wrapErr(name, err)
+	}
+	// GetObject is lazy, stat the object to surface missing objects before the first read.
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, b.wrapErr(name, err)
+	}
+	return obj, nil
+}
+
+// List returns the objects below the configured prefix whose name starts with prefix.
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	keyPrefix := prefix
+	if b.cfg.prefix != "" {
+		keyPrefix = b.cfg.prefix + "/" + prefix
+	}
+
+	var objects []ObjectInfo
+	opts := minio.ListObjectsOptions{Prefix: keyPrefix, Recursive: true}
+	for obj := range b.client.ListObjects(ctx, b.cfg.bucket, opts) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", b.Location(prefix), obj.Err)
+		}
+		objects = append(objects, ObjectInfo{Name: b.name(obj.Key), Size: obj.Size, ModTime: obj.LastModified})
+	}
+	return objects, nil
+}
+
+// Delete removes the named object.
+func (b *S3Backend) Delete(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+	if err := b.client.RemoveObject(ctx, b.cfg.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return b.wrapErr(name, err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of the named object.
+func (b *S3Backend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := b.client.StatObject(ctx, b.cfg.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, b.wrapErr(name, err)
+	}
+	return ObjectInfo{Name: name, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// Location returns the s3:// URL of the named object.
+func (b *S3Backend) Location(name string) string {
+	return "s3://" + path.Join(b.cfg.bucket, b.cfg.prefix, name)
+}
+
+// key returns the object key of the named object, rejecting names that escape the configured prefix.
+func (b *S3Backend) key(name string) (string, error) {
+	clean, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(b.cfg.prefix, clean), nil
+}
+
+// name returns the object name of the given key, relative to the configured prefix.
+func (b *S3Backend) name(key string) string {
+	if b.cfg.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, b.cfg.prefix+"/")
+}
+
+// wrapErr converts S3 missing object errors into ErrNotFound.
+func (b *S3Backend) wrapErr(name string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", ErrNotFound, b.Location(name))
+	}
+	return fmt.Errorf("%s: %w", b.Location(name), err)
+}
+
+// firstNonEmpty returns the first of the given values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"net/url"
+	"os"
+	"testing"
+)
+
+// TestParseS3URL verifies that the bucket, prefix and query parameters of an s3:// URL are parsed.
+func TestParseS3URL(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_REGION", "")
+
+	u, _ := url.Parse("s3://backups/hosts/web-1?endpoint=http://localhost:9000&region=eu-west-1&sse=AES256&storage-class=STANDARD_IA&part-size=32MiB")
+	cfg, err := parseS3URL(u, os.Getenv)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	expected := s3Config{
+		bucket:       "backups",
+		prefix:       "hosts/web-1",
+		endpoint:     "localhost:9000",
+		secure:       false,
+		region:       "eu-west-1",
+		sse:          "AES256",
+		storageClass: "STANDARD_IA",
+		partSize:     32 << 20,
+	}
+	if cfg != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
+
+// TestParseS3URL_defaults verifies that an s3:// URL with only a bucket takes its endpoint and region from the
+// environment.
+func TestParseS3URL_defaults(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "https://minio.example.com/")
+	t.Setenv("AWS_REGION", "us-east-2")
+
+	u, _ := url.Parse("s3://backups")
+	cfg, err := parseS3URL(u, os.Getenv)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if cfg.endpoint != "minio.example.com" || !cfg.secure {
+		t.Errorf("expected secure endpoint minio.example.com, got %s (secure %t)", cfg.endpoint, cfg.secure)
+	}
+	if cfg.region != "us-east-2" {
+		t.Errorf("expected region us-east-2, got %s", cfg.region)
+	}
+	if cfg.partSize != defaultS3PartSize {
+		t.Errorf("expected default part size, got %d", cfg.partSize)
+	}
+}
+
+// TestParseS3URL_errors verifies that s3:// URLs with a missing bucket or invalid options are rejected.
+func TestParseS3URL_errors(t *testing.T) {
+	for _, rawURL := range []string{
+		"s3:///prefix",
+		"s3://bucket?sse=unknown",
+		"s3://bucket?sse=aws:kms",
+		"s3://bucket?part-size=1MiB",
+		"s3://bucket?part-size=lots",
+	} {
+		u, _ := url.Parse(rawURL)
+		if _, err := parseS3URL(u, os.Getenv); err == nil {
+			t.Errorf("expected error for %s, got nil", rawURL)
+		}
+	}
+}
+
+// TestS3Backend_keys verifies the mapping between object names and keys below the prefix, and that names escaping
+// the prefix are rejected.
+func TestS3Backend_keys(t *testing.T) {
+	b := &S3Backend{cfg: s3Config{bucket: "backups", prefix: "hosts/web-1"}}
+
+	if key, err := b.key("data-1.tar"); err != nil || key != "hosts/web-1/data-1.tar" {
+		t.Errorf("expected key hosts/web-1/data-1.tar, got %s (%v)", key, err)
+	}
+	for _, name := range []string{"", "../web-2/data-1.tar", "/data-1.tar"} {
+		if _, err := b.key(name); err == nil {
+			t.Errorf("expected error for %q, got nil", name)
+		}
+	}
+	if name := b.name("hosts/web-1/data-1.tar"); name != "data-1.tar" {
+		t.Errorf("expected name data-1.tar, got %s", name)
+	}
+	if loc := b.Location("data-1.tar"); loc != "s3://backups/hosts/web-1/data-1.tar" {
+		t.Errorf("expected location s3://backups/hosts/web-1/data-1.tar, got %s", loc)
+	}
+}
@@ -0,0 +1,235 @@
+package storage_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// s3Server is an in-process S3 endpoint keeping the objects of a single bucket in memory. It implements the subset of
+// the API used by the S3 backend: multipart uploads, object reads, deletes and listings.
+type s3Server struct {
+	bucket    string
+	accessKey string
+
+	mu      sync.Mutex
+	objects map[string]s3Object
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+// s3Object is an object stored by s3Server.
+type s3Object struct {
+	data    []byte
+	modTime time.Time
+}
+
+// startS3Server starts an S3 endpoint serving the given bucket to requests signed with accessKey.
+func startS3Server(t *testing.T, bucket, accessKey string) *httptest.Server {
+	t.Helper()
+	s := &s3Server{
+		bucket:    bucket,
+		accessKey: accessKey,
+		objects:   make(map[string]s3Object),
+		uploads:   make(map[string]map[int][]byte),
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// ServeHTTP serves the S3 requests of the backend, rejecting requests not signed with the access key.
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.accessKey+"/") {
+		s3Error(w, http.StatusForbidden, "InvalidAccessKeyId")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, q.Get("prefix"))
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		parts, ok := s.uploads[q.Get("uploadId")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		data, err := readS3Body(r)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		parts[n] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		parts, ok := s.uploads[q.Get("uploadId")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, parts[n]...)
+		}
+		delete(s.uploads, q.Get("uploadId"))
+		s.objects[key] = s3Object{data: data, modTime: time.Now()}
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: `"object"`})
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(s.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"object"`)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// list writes the objects of the bucket whose key starts with prefix, as a single page.
+func (s *s3Server) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: s.bucket, Prefix: prefix}
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				LastModified: obj.modTime.UTC().Format(time.RFC3339),
+				ETag:         `"object"`,
+				Size:         len(obj.data),
+			})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	writeXML(w, result)
+}
+
+// readS3Body returns the payload of r, decoding the aws-chunked encoding of streaming signed uploads.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, br, n); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeXML writes v as the XML body of a successful response.
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+// s3Error writes an S3 error response with the given status and code.
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+// TestS3Backend_fakeServer runs the backend tests against an in-process S3 endpoint, with the credentials given as
+// options rather than through the environment.
+func TestS3Backend_fakeServer(t *testing.T) {
+	srv := startS3Server(t, "backups", "AKIATEST")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAOTHER")
+
+	rawURL := "s3://backups/hosts/web-1?region=us-east-1&endpoint=" + srv.URL
+	b, err := storage.Open(context.Background(), rawURL, storage.WithEnv(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIATEST",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	}))
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", rawURL, err)
+	}
+	testBackend(t, b)
+}
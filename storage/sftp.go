@@ -0,0 +1,497 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// defaultSFTPPort is the port used when the URL does not specify one.
+	defaultSFTPPort = "22"
+
+	// sftpDialTimeout bounds the time spent establishing the SSH connection.
+	sftpDialTimeout = 30 * time.Second
+
+	// sftpChunkSize is the size of the chunks read from the archive stream and written to the server.
+	sftpChunkSize = 256 * 1024
+
+	// sftpUploadAttempts is the number of times an upload is resumed after the connection to the server failed.
+	sftpUploadAttempts = 3
+)
+
+// defaultIdentityFiles are the private keys, relative to ~/.ssh, tried when the URL does not name an identity file.
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sftpConfig holds the settings of an SFTP backend parsed from an sftp:// URL.
+type sftpConfig struct {
+	user       string
+	addr       string
+	root       string
+	identity   string
+	knownHosts string
+}
+
+// parseSFTPURL parses a URL of the form sftp://user@host:port/path?identity=...&known-hosts=...
+// The path is absolute on the server, unless it starts with /~/ in which case it is relative to the login directory.
+// The user defaults to the current user, and known-hosts to ~/.ssh/known_hosts.
+func parseSFTPURL(u *url.URL) (sftpConfig, error) {
+	if u.Hostname() == "" {
+		return sftpConfig{}, fmt.Errorf("missing host in SFTP URL %q", u.String())
+	}
+
+	q := u.Query()
+	cfg := sftpConfig{
+		user:       u.User.Username(),
+		addr:       net.JoinHostPort(u.Hostname(), firstNonEmpty(u.Port(), defaultSFTPPort)),
+		identity:   expandHome(q.Get("identity")),
+		knownHosts: expandHome(firstNonEmpty(q.Get("known-hosts"), "~/.ssh/known_hosts")),
+	}
+	if cfg.user == "" {
+		current, err := user.Current()
+		if err != nil {
+			return sftpConfig{}, fmt.Errorf("missing user in SFTP URL %q: %w", u.String(), err)
+		}
+		cfg.user = current.Username
+	}
+
+	switch {
+	case u.Path == "/~" || u.Path == "":
+		cfg.root = "."
+	case strings.HasPrefix(u.Path, "/~/"):
+		cfg.root = path.Clean(strings.TrimPrefix(u.Path, "/~/"))
+	default:
+		cfg.root = path.Clean(u.Path)
+	}
+	return cfg, nil
+}
+
+// expandHome replaces a leading ~/ in p with the home directory of the current user.
+func expandHome(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[2:])
+}
+
+// SFTPBackend stores objects as files below a root directory on an SSH server. The connection is established on
+// first use and re-established when it breaks.
+type SFTPBackend struct {
+	cfg    sftpConfig
+	ssh    *ssh.ClientConfig
+	agent  net.Conn
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// openSFTPURL returns the SFTPBackend addressed by an sftp:// URL. Keys are taken from the identity file named in the
+// URL and from the ssh-agent listening on SSH_AUTH_SOCK. Without an identity file, the default keys in ~/.ssh are
+// tried. A passphrase-protected identity file is decrypted with AERO_SFTP_PASSPHRASE. The host key of the server
+// must be listed in the known hosts file. Environment variables are read with getenv.
+func openSFTPURL(u *url.URL, getenv func(string) string) (*SFTPBackend, error) {
+	cfg, err := parseSFTPURL(u)
+	if err != nil {
+		return nil, err
+	}
+	b := &SFTPBackend{cfg: cfg}
+
+	signers, err := loadIdentities(cfg.identity, getenv("AERO_SFTP_PASSPHRASE"))
+	if err != nil {
+		return nil, err
+	}
+	auth := []ssh.AuthMethod{}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if sock := getenv("SSH_AUTH_SOCK"); sock != "" {
+		if b.agent, err = net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(b.agent).Signers))
+		}
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("no SSH keys available, set identity in the URL or start an ssh-agent")
+	}
+
+	hostKeyCallback, err := knownhosts.New(cfg.knownHosts)
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	b.ssh = &ssh.ClientConfig{
+		User:              cfg.user,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: knownHostKeyAlgorithms(hostKeyCallback, cfg.addr),
+		Timeout:           sftpDialTimeout,
+	}
+	return b, nil
+}
+
+// loadIdentities returns the signers of the given identity file, or of the default identity files when it is empty.
+// Default identity files that are missing or protected by another passphrase are skipped.
+func loadIdentities(identity, passphrase string) ([]ssh.Signer, error) {
+	if identity != "" {
+		signer, err := loadIdentity(identity, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load identity %s: %w", identity, err)
+		}
+		return []ssh.Signer{signer}, nil
+	}
+
+	var signers []ssh.Signer
+	for _, name := range defaultIdentityFiles {
+		if signer, err := loadIdentity(expandHome("~/.ssh/"+name), passphrase); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	return signers, nil
+}
+
+// loadIdentity parses the private key in the named file, decrypting it with the passphrase if needed.
+func loadIdentity(name, passphrase string) (ssh.Signer, error) {
+	key, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	return signer, err
+}
+
+// knownHostKeyAlgorithms returns the algorithms of the host keys known for addr, so that the server is asked for a
+// key that can be verified. It returns nil, accepting any algorithm, when the host is unknown.
+func knownHostKeyAlgorithms(cb ssh.HostKeyCallback, addr string) []string {
+	// Checking a key that cannot match reports the known keys of the host.
+	var keyErr *knownhosts.KeyError
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	if err := cb(addr, tcpAddr, invalidHostKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch known.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	return algorithms
+}
+
+// invalidHostKey is a public key that matches no known host key.
+type invalidHostKey struct{}
+
+// Type returns an algorithm name that no host key has.
+func (invalidHostKey) Type() string { return "invalid" }
+
+// Marshal returns a wire encoding that no host key has.
+func (invalidHostKey) Marshal() []byte { return []byte("invalid") }
+
+// Verify rejects every signature.
+func (invalidHostKey) Verify([]byte, *ssh.Signature) error { return errors.New("invalid host key") }
+
+// connect returns the SFTP client of the backend, dialing the server if there is no open connection.
+func (b *SFTPBackend) connect(ctx context.Context) (*sftp.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	d := net.Dialer{Timeout: sftpDialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", b.cfg.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", b.cfg.addr, err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(nc, b.cfg.addr, b.ssh)
+	if err != nil {
+		_ = nc.Close()
+		return nil, fmt.Errorf("failed to establish SSH connection to %s: %w", b.cfg.addr, err)
+	}
+	conn := ssh.NewClient(c, chans, reqs)
+
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP session on %s: %w", b.cfg.addr, err)
+	}
+	b.conn, b.client = conn, client
+	return client, nil
+}
+
+// disconnect closes the connection to the server, if any, so that the next operation dials a new one.
+func (b *SFTPBackend) disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		_ = b.client.Close()
+		_ = b.conn.Close()
+		b.client, b.conn = nil, nil
+	}
+}
+
+// Close closes the connection to the server and to the ssh-agent.
+func (b *SFTPBackend) Close() error {
+	b.disconnect()
+	if b.agent != nil {
+		return b.agent.Close()
+	}
+	return nil
+}
+
+// sftpUpload tracks the progress of an upload so that it can be resumed on a new connection.
+type sftpUpload struct {
+	r       io.Reader
+	buf     []byte
+	pending []byte
+	written int64
+	eof     bool
+}
+
+// Put writes the content read from r to a temporary file and renames it to the named file once complete, so that
+// partially uploaded archives never appear under their final name. If the connection breaks during the upload, it is
+// re-established and the upload resumes from the last byte acknowledged by the server.
+func (b *SFTPBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	p, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(p), tmpPrefix+path.Base(p))
+
+	up := &sftpUpload{r: contextReader{ctx: ctx, r: r}, buf: make([]byte, sftpChunkSize)}
+	for attempt := 1; ; attempt++ {
+		retry, err := b.upload(ctx, tmp, up)
+		if err == nil {
+			break
+		}
+		if !retry || attempt == sftpUploadAttempts || ctx.Err() != nil {
+			return fmt.Errorf("failed to upload %s: %w", b.Location(name), err)
+		}
+		b.disconnect()
+	}
+
+	client, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(client, tmp, p); err != nil {
+		return fmt.Errorf("failed to rename temporary file to %s: %w", b.Location(name), err)
+	}
+	return nil
+}
+
+// replaceFile renames the file tmp to p, replacing the existing file. The rename is atomic on servers supporting the
+// posix-rename extension. Other servers refuse to rename over an existing file, so the existing file is first renamed
+// aside, and renamed back if tmp cannot take its place. This fallback is not atomic: p is briefly missing, and is
+// left under its aside name, which List ignores, if the connection breaks in the meantime.
+func replaceFile(client *sftp.Client, tmp, p string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(tmp, p)
+	}
+
+	old := path.Join(path.Dir(p), tmpPrefix+"old-"+path.Base(p))
+	// A file left aside by an interrupted replace is superseded by tmp.
+	_ = client.Remove(old)
+	if err := client.Rename(p, old); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return client.Rename(tmp, p)
+	}
+	if err := client.Rename(tmp, p); err != nil {
+		if restoreErr := client.Rename(old, p); restoreErr != nil {
+			return fmt.Errorf("%w, and the previous file was left at %s: %w", err, old, restoreErr)
+		}
+		return err
+	}
+	_ = client.Remove(old)
+	return nil
+}
+
+// upload writes the rest of the upload to the temporary file tmp, starting at the last acknowledged byte. It reports
+// whether a failed upload may be resumed, which is the case for failures of the connection but not of the source.
+func (b *SFTPBackend) upload(ctx context.Context, tmp string, up *sftpUpload) (bool, error) {
+	client, err := b.connect(ctx)
+	if err != nil {
+		return true, err
+	}
+	if err := client.MkdirAll(path.Dir(tmp)); err != nil {
+		return true, fmt.Errorf("failed to create directory %s: %w", path.Dir(tmp), err)
+	}
+
+	f, err := client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return true, err
+	}
+	defer f.Close()
+
+	// Discard anything written past the acknowledged bytes by the interrupted attempt.
+	if err := f.Truncate(up.written); err != nil {
+		return true, err
+	}
+	if _, err := f.Seek(up.written, io.SeekStart); err != nil {
+		return true, err
+	}
+
+	for !up.eof || len(up.pending) > 0 {
+		if len(up.pending) == 0 {
+			n, err := up.r.Read(up.buf)
+			up.pending = up.buf[:n]
+			if errors.Is(err, io.EOF) {
+				up.eof = true
+			} else if err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		if _, err := f.Write(up.pending); err != nil {
+			return true, err
+		}
+		up.written += int64(len(up.pending))
+		up.pending = nil
+	}
+	return true, f.Close()
+}
+
+// Get opens the named file for reading.
+func (b *SFTPBackend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := b.path(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := client.Open(p)
+	if err != nil {
+		return nil, b.wrapErr(name, err)
+	}
+	return f, nil
+}
+
+// List walks the root directory and returns the files whose name starts with prefix.
+// Temporary files of uploads in progress are skipped.
+func (b *SFTPBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	client, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	walker := client.Walk(b.cfg.root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == b.cfg.root && errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to list %s: %w", b.Location(prefix), err)
+		}
+
+		info := walker.Stat()
+		if info.IsDir() || strings.HasPrefix(info.Name(), tmpPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), b.cfg.root), "/")
+		if b.cfg.root == "." {
+			name = walker.Path()
+		}
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+// Delete removes the named file.
+func (b *SFTPBackend) Delete(ctx context.Context, name string) error {
+	p, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	client, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.Remove(p); err != nil {
+		return b.wrapErr(name, err)
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of the named file.
+func (b *SFTPBackend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	p, err := b.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	client, err := b.connect(ctx)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := client.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, b.wrapErr(name, err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory", name)
+	}
+	return ObjectInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Location returns the sftp:// URL of the named file.
+func (b *SFTPBackend) Location(name string) string {
+	root := b.cfg.root
+	if !path.IsAbs(root) {
+		root = path.Join("/~", root)
+	}
+	return "sftp://" + b.cfg.user + "@" + b.cfg.addr + path.Join(root, name)
+}
+
+// path returns the path on the server of the named object, rejecting names that escape the root directory.
+func (b *SFTPBackend) path(name string) (string, error) {
+	clean, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(b.cfg.root, clean), nil
+}
+
+// wrapErr converts missing file errors into ErrNotFound.
+func (b *SFTPBackend) wrapErr(name string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, b.Location(name))
+	}
+	return fmt.Errorf("%s: %w", b.Location(name), err)
+}
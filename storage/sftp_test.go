@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"net/url"
+	"testing"
+)
+
+// TestParseSFTPURL verifies that the user, address, root and query parameters of an sftp:// URL are parsed.
+func TestParseSFTPURL(t *testing.T) {
+	u, _ := url.Parse("sftp://backup@nas.example.com:2222/srv/backups/?identity=/keys/id_ed25519&known-hosts=/keys/known_hosts")
+	cfg, err := parseSFTPURL(u)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	expected := sftpConfig{
+		user:       "backup",
+		addr:       "nas.example.com:2222",
+		root:       "/srv/backups",
+		identity:   "/keys/id_ed25519",
+		knownHosts: "/keys/known_hosts",
+	}
+	if cfg != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
+
+// TestParseSFTPURL_home verifies that roots below ~ are relative to the home directory and that the port defaults.
+func TestParseSFTPURL_home(t *testing.T) {
+	for rawURL, root := range map[string]string{
+		"sftp://backup@nas.example.com":             ".",
+		"sftp://backup@nas.example.com/~":           ".",
+		"sftp://backup@nas.example.com/~/backups/":  "backups",
+		"sftp://backup@nas.example.com/srv/backups": "/srv/backups",
+	} {
+		u, _ := url.Parse(rawURL)
+		cfg, err := parseSFTPURL(u)
+		if err != nil {
+			t.Fatalf("expected no error for %s, got %s", rawURL, err)
+		}
+		if cfg.root != root {
+			t.Errorf("expected root %s for %s, got %s", root, rawURL, cfg.root)
+		}
+		if cfg.addr != "nas.example.com:22" {
+			t.Errorf("expected default port, got %s", cfg.addr)
+		}
+	}
+}
+
+// TestParseSFTPURL_errors verifies that sftp:// URLs without a host are rejected.
+func TestParseSFTPURL_errors(t *testing.T) {
+	u, _ := url.Parse("sftp:///srv/backups")
+	if _, err := parseSFTPURL(u); err == nil {
+		t.Error("expected error for missing host, got nil")
+	}
+}
+
+// TestSFTPBackend_Location verifies the locations of objects below home relative and absolute roots.
+func TestSFTPBackend_Location(t *testing.T) {
+	b := &SFTPBackend{cfg: sftpConfig{user: "backup", addr: "nas:22", root: "backups"}}
+	if loc := b.Location("data-1.tar"); loc != "sftp://backup@nas:22/~/backups/data-1.tar" {
+		t.Errorf("expected home relative location, got %s", loc)
+	}
+
+	b.cfg.root = "/srv/backups"
+	if loc := b.Location("data-1.tar"); loc != "sftp://backup@nas:22/srv/backups/data-1.tar" {
+		t.Errorf("expected absolute location, got %s", loc)
+	}
+}
@@ -0,0 +1,278 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/storage"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpServer is an in-process SSH server exposing the local filesystem over SFTP.
+type sftpServer struct {
+	addr       string
+	identity   string
+	knownHosts string
+
+	// dropAfter, when positive, closes the first connection once the server has received that many bytes.
+	dropAfter int64
+
+	mu    sync.Mutex
+	conns int
+}
+
+// startSFTPServer starts an SFTP server accepting a freshly generated client key, and writes the client identity and
+// a known hosts file listing the server key to a temporary directory. A positive dropAfter makes the server drop the
+// first connection after receiving that many bytes.
+func startSFTPServer(t *testing.T, dropAfter int64) *sftpServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	authorized, _ := ssh.NewPublicKey(clientPub)
+
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &sftpServer{
+		identity:   filepath.Join(dir, "id_ed25519"),
+		knownHosts: filepath.Join(dir, "known_hosts"),
+		dropAfter:  dropAfter,
+	}
+	if err := os.WriteFile(s.identity, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s.addr = l.Addr().String()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, hostSigner.PublicKey())
+	if err := os.WriteFile(s.knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(s.wrap(nc), config)
+		}
+	}()
+	return s
+}
+
+// wrap returns the connection, set to drop after dropAfter bytes if it is the first one.
+func (s *sftpServer) wrap(nc net.Conn) net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns++
+	if s.conns == 1 && s.dropAfter > 0 {
+		return &droppingConn{Conn: nc, remaining: s.dropAfter}
+	}
+	return nc
+}
+
+// connections returns the number of connections accepted so far.
+func (s *sftpServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// serve runs the SFTP subsystem for the sessions of the given connection.
+func (s *sftpServer) serve(nc net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		ch, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				_ = req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		go func() {
+			defer ch.Close()
+			server, err := sftp.NewServer(ch)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+		}()
+	}
+}
+
+// url returns the sftp:// URL of the given directory on the server.
+func (s *sftpServer) url(dir string) string {
+	q := url.Values{"identity": {s.identity}, "known-hosts": {s.knownHosts}}
+	return "sftp://aero@" + s.addr + filepath.ToSlash(dir) + "?" + q.Encode()
+}
+
+// droppingConn is a connection that closes itself once it has read a given number of bytes.
+type droppingConn struct {
+	net.Conn
+	remaining int64
+}
+
+// Read reads from the connection, closing it once the byte budget is exhausted.
+func (c *droppingConn) Read(p []byte) (int, error) {
+	if c.remaining <= 0 {
+		c.Conn.Close()
+		return 0, io.ErrClosedPipe
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.Conn.Read(p)
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// openSFTPBackend opens the backend addressed by rawURL without an SSH agent, and closes it when the test ends.
+func openSFTPBackend(t *testing.T, rawURL string) storage.Backend {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+	b, err := storage.Open(context.Background(), rawURL)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", rawURL, err)
+	}
+	t.Cleanup(func() { storage.Close(b) })
+	return b
+}
+
+// TestSFTPBackend runs the backend tests against an in-process SFTP server.
+func TestSFTPBackend(t *testing.T) {
+	s := startSFTPServer(t, 0)
+	testBackend(t, openSFTPBackend(t, s.url(t.TempDir())))
+}
+
+// TestSFTPBackend_ListMissingRoot verifies that listing a missing root directory returns no objects.
+func TestSFTPBackend_ListMissingRoot(t *testing.T) {
+	s := startSFTPServer(t, 0)
+	b := openSFTPBackend(t, s.url(filepath.Join(t.TempDir(), "missing")))
+
+	objects, err := b.List(context.Background(), "")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("expected no objects, got %+v", objects)
+	}
+}
+
+// TestSFTPBackend_ResumeUpload verifies that an upload interrupted by a dropped connection is resumed on a new one.
+func TestSFTPBackend_ResumeUpload(t *testing.T) {
+	s := startSFTPServer(t, 1<<20)
+	dir := t.TempDir()
+	b := openSFTPBackend(t, s.url(dir))
+
+	data := make([]byte, 4<<20)
+	_, _ = rand.Read(data)
+	if err := b.Put(context.Background(), "data-1.tar", bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(dir, "data-1.tar"))
+	if err != nil {
+		t.Fatalf("expected archive to be stored, got %s", err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Errorf("expected resumed upload to match source, got %d bytes instead of %d", len(stored), len(data))
+	}
+	if n := s.connections(); n < 2 {
+		t.Errorf("expected the upload to reconnect, got %d connections", n)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected temporary file to be renamed, got %d entries", len(entries))
+	}
+}
+
+// TestSFTPBackend_ReplaceWithoutPosixRename verifies that files are replaced on servers without the posix-rename
+// extension, without leaving the previous file behind.
+func TestSFTPBackend_ReplaceWithoutPosixRename(t *testing.T) {
+	if err := sftp.SetSFTPExtensions("hardlink@openssh.com", "statvfs@openssh.com"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = sftp.SetSFTPExtensions("hardlink@openssh.com", "posix-rename@openssh.com", "statvfs@openssh.com")
+	})
+
+	s := startSFTPServer(t, 0)
+	dir := t.TempDir()
+	b := openSFTPBackend(t, s.url(dir))
+
+	for _, content := range []string{"first", "second"} {
+		if err := b.Put(context.Background(), "data-1.tar", strings.NewReader(content)); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, "data-1.tar"))
+	if err != nil || string(stored) != "second" {
+		t.Errorf("expected file to be replaced, got %q, %v", stored, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected the previous file to be removed, got %d entries", len(entries))
+	}
+}
+
+// TestSFTPBackend_UnknownHost verifies that servers whose host key is not in the known hosts file are rejected.
+func TestSFTPBackend_UnknownHost(t *testing.T) {
+	s := startSFTPServer(t, 0)
+	if err := os.WriteFile(s.knownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b := openSFTPBackend(t, s.url(t.TempDir()))
+
+	err := b.Put(context.Background(), "data-1.tar", strings.NewReader("data"))
+	if err == nil || !strings.Contains(err.Error(), "key is unknown") {
+		t.Errorf("expected unknown host key error, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package storage provides the backends backups are written to and read from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested object does not exist in the backend.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes an object stored in a backend.
+type ObjectInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Backend defines the operations a storage destination must support to hold backup archives.
+// Object names are slash separated paths relative to the root of the backend.
+type Backend interface {
+	// Put stores the content read from r under the given name, replacing any existing object.
+	Put(ctx context.Context, name string, r io.Reader) error
+
+	// Get returns a reader for the content of the named object.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// List returns the objects whose name starts with prefix, sorted by name.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+
+	// Delete removes the named object.
+	Delete(ctx context.Context, name string) error
+
+	// Stat returns information about the named object.
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+
+	// Location returns a human-readable location of the named object, such as a path or a URL.
+	Location(name string) string
+}
+
+// Option configures the backends returned by Open.
+type Option func(*openOptions)
+
+// openOptions holds the settings of the backends returned by Open.
+type openOptions struct {
+	env map[string]string
+}
+
+// WithEnv sets the environment variables read by the backend, such as AWS_SECRET_ACCESS_KEY or AZURE_STORAGE_KEY,
+// to the values of env rather than the values from the environment of the process, which is left unchanged. This
+// lets backends of the same type use different credentials. Variables missing from env are read from the process.
+func WithEnv(env map[string]string) Option {
+	return func(o *openOptions) {
+		o.env = env
+	}
+}
+
+// getenv returns the value of the named environment variable as seen by the backend.
+func (o *openOptions) getenv(name string) string {
+	if value, ok := o.env[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Open returns the backend addressed by rawURL. URLs without a scheme are treated as local filesystem paths.
+func Open(ctx context.Context, rawURL string, opts ...Option) (Backend, error) {
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !strings.Contains(rawURL, "://") {
+		return NewFileBackend(rawURL)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL %q: %w", rawURL, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return openFileURL(u)
+	case "s3":
+		return openS3URL(u, o.getenv)
+	case "azblob":
+		return openAzblobURL(u, o.getenv)
+	case "sftp":
+		return openSFTPURL(u, o.getenv)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme %q", u.Scheme)
+	}
+}
+
+// OpenObject returns the backend holding the object addressed by rawURL, such as s3://bucket/prefix/data.tar, along
+// with the name of the object in that backend. The URL is split as done by SplitObject.
+func OpenObject(ctx context.Context, rawURL string, opts ...Option) (Backend, string, error) {
+	location, name, err := SplitObject(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := Open(ctx, location, opts...)
+	return b, name, err
+}
+
+// SplitObject splits the URL of an object, such as s3://bucket/prefix/data.tar, into the URL of the backend holding
+// it and the name of the object in that backend. The last path element of the URL is the object name and the rest of
+// the URL, query parameters included, addresses the backend. URLs without a scheme are local filesystem paths.
+func SplitObject(rawURL string) (string, string, error) {
+	if !strings.Contains(rawURL, "://") {
+		return filepath.Dir(rawURL), filepath.Base(rawURL), nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid storage URL %q: %w", rawURL, err)
+	}
+	dir, name := path.Split(u.Path)
+	if name == "" {
+		return "", "", fmt.Errorf("storage URL %q does not address an object", rawURL)
+	}
+	u.Path = strings.TrimSuffix(dir, "/")
+	u.RawPath = ""
+	return u.String(), name, nil
+}
+
+// Close releases the resources held by b, such as network connections, if it holds any.
+func Close(b Backend) error {
+	if c, ok := b.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// cleanName returns the cleaned form of the object name, rejecting empty names and names that escape the root of
+// the backend.
+func cleanName(name string) (string, error) {
+	clean := path.Clean(name)
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(clean)) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,124 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// testBackend exercises the Backend contract against b. Backends pointing at shared services should be given an
+// empty prefix, since the test lists and deletes the objects it writes.
+func testBackend(t *testing.T, b storage.Backend) {
+	t.Helper()
+	ctx := context.Background()
+
+	names := []string{"data-2.tar", "data-1.tar", "db/db-1.tar.gz"}
+	for _, name := range names {
+		if err := b.Put(ctx, name, strings.NewReader(name)); err != nil {
+			t.Fatalf("failed to put %s: %s", name, err)
+		}
+	}
+	defer func() {
+		for _, name := range names {
+			_ = b.Delete(ctx, name)
+		}
+	}()
+
+	objects, err := b.List(ctx, "data-")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(objects) != 2 || objects[0].Name != "data-1.tar" || objects[1].Name != "data-2.tar" {
+		t.Errorf("unexpected objects %+v", objects)
+	}
+
+	info, err := b.Stat(ctx, "db/db-1.tar.gz")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if info.Size != int64(len("db/db-1.tar.gz")) {
+		t.Errorf("expected size %d, got %d", len("db/db-1.tar.gz"), info.Size)
+	}
+
+	rc, err := b.Get(ctx, "data-1.tar")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "data-1.tar" {
+		t.Errorf("expected content 'data-1.tar', got %q", data)
+	}
+
+	if err := b.Delete(ctx, "data-1.tar"); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if _, err := b.Stat(ctx, "data-1.tar"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := b.Get(ctx, "data-1.tar"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// openTestBackend opens the backend addressed by the URL in the given environment variable, skipping the test when
+// it is not set. This allows running the backend tests against local emulators.
+func openTestBackend(t *testing.T, env string) storage.Backend {
+	t.Helper()
+	rawURL := os.Getenv(env)
+	if rawURL == "" {
+		t.Skipf("%s is not set", env)
+	}
+	b, err := storage.Open(context.Background(), rawURL)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", rawURL, err)
+	}
+	return b
+}
+
+// TestS3Backend runs the backend tests against the bucket addressed by AERO_TEST_S3_URL, for example a local MinIO
+// server at s3://test?endpoint=http://localhost:9000 with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY set.
+func TestS3Backend(t *testing.T) {
+	testBackend(t, openTestBackend(t, "AERO_TEST_S3_URL"))
+}
+
+// TestAzblobBackend runs the backend tests against the container addressed by AERO_TEST_AZBLOB_URL, for example the
+// Azurite emulator at azblob://devstoreaccount1/test?endpoint=http://127.0.0.1:10000/devstoreaccount1 with
+// AZURE_STORAGE_KEY set to the well-known Azurite account key.
+func TestAzblobBackend(t *testing.T) {
+	testBackend(t, openTestBackend(t, "AERO_TEST_AZBLOB_URL"))
+}
+
+// TestOpenObject verifies that object URLs are split into the backend of their directory and the object name.
+func TestOpenObject(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, rawURL := range []string{dir + "/data-1.tar", "file://" + dir + "/data-1.tar"} {
+		b, name, err := storage.OpenObject(ctx, rawURL)
+		if err != nil {
+			t.Fatalf("expected no error for %s, got %s", rawURL, err)
+		}
+		if name != "data-1.tar" || b.Location(name) != filepath.Join(dir, "data-1.tar") {
+			t.Errorf("unexpected object %s at %s for %s", name, b.Location(name), rawURL)
+		}
+	}
+
+	b, name, err := storage.OpenObject(ctx, "s3://my-bucket/backups/data-1.tar.gz?region=eu-west-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if name != "data-1.tar.gz" || b.Location(name) != "s3://my-bucket/backups/data-1.tar.gz" {
+		t.Errorf("unexpected object %s at %s", name, b.Location(name))
+	}
+
+	if _, _, err := storage.OpenObject(ctx, "s3://my-bucket/backups/"); err == nil {
+		t.Errorf("expected error for a URL without object name, got nil")
+	}
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// defaultSyncConcurrency is the number of objects copied in parallel when SyncOptions does not set a concurrency.
+const defaultSyncConcurrency = 4
+
+// manifestExtension is the suffix of the manifests stored alongside the archives, as named by the dockerbackup
+// package. Manifests record the SHA-256 digest of their archive.
+const manifestExtension = ".manifest.json"
+
+// SyncOp is the operation applied to an object to bring the destination in line with the source.
+type SyncOp string
+
+const (
+	// SyncCopy copies an object missing from the destination.
+	SyncCopy SyncOp = "copy"
+
+	// SyncUpdate replaces an object of the destination that differs from the source.
+	SyncUpdate SyncOp = "update"
+
+	// SyncDelete removes an object of the destination that is missing from the source.
+	SyncDelete SyncOp = "delete"
+)
+
+// SyncOptions configures how Sync replicates objects between backends.
+type SyncOptions struct {
+	// Prefix restricts the synchronization to the objects whose name starts with it.
+	Prefix string
+
+	// Checksum compares objects of the same size without a manifest by their SHA-256 digest, which requires reading
+	// both copies. Without it, such objects of the same name and size are considered identical.
+	Checksum bool
+
+	// Delete removes the objects of the destination that are missing from the source, mirroring the source.
+	Delete bool
+
+	// DryRun plans the synchronization without applying it.
+	DryRun bool
+
+	// Concurrency is the number of objects copied in parallel. It defaults to 4.
+	Concurrency int
+}
+
+// SyncAction describes an operation planned or applied by Sync. Err is set when applying the action failed.
+type SyncAction struct {
+	Op     SyncOp
+	Name   string
+	Size   int64
+	Reason string
+	Err    error
+}
+
+// MarshalJSON encodes the action, replacing the error with its message.
+func (a SyncAction) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Op     SyncOp `json:"op"`
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		Reason string `json:"reason"`
+		Error  string `json:"error,omitempty"`
+	}{Op: a.Op, Name: a.Name, Size: a.Size, Reason: a.Reason}
+	if a.Err != nil {
+		out.Error = a.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// SyncReport lists the actions planned or applied by Sync, along with the number of objects already in sync.
+type SyncReport struct {
+	Source      string       `json:"source"`
+	Destination string       `json:"destination"`
+	DryRun      bool         `json:"dry_run"`
+	Unchanged   int          `json:"unchanged"`
+	Actions     []SyncAction `json:"actions"`
+}
+
+// Failed returns the actions that could not be applied.
+func (r *SyncReport) Failed() []SyncAction {
+	var failed []SyncAction
+	for _, a := range r.Actions {
+		if a.Err != nil {
+			failed = append(failed, a)
+		}
+	}
+	return failed
+}
+
+// Err returns an error joining the failures of all actions, or nil if every action succeeded.
+func (r *SyncReport) Err() error {
+	var errs []error
+	for _, a := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s %s: %w", a.Op, a.Name, a.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// Sync replicates the objects of src to dst. Objects missing from dst are copied, objects that differ are replaced,
+// and with opts.Delete objects missing from src are removed from dst. Archives of the same size are compared by the
+// digest recorded in their manifests when both copies have one. A failing object is recorded in the report and
+// does not stop the synchronization of the remaining objects. An error is returned only if a backend cannot be
+// listed or compared.
+func Sync(ctx context.Context, src, dst Backend, opts SyncOptions) (*SyncReport, error) {
+	report, err := planSync(ctx, src, dst, opts)
+	if err != nil || opts.DryRun {
+		return report, err
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultSyncConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range report.Actions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(a *SyncAction) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			a.Err = applySyncAction(ctx, src, dst, a)
+		}(&report.Actions[i])
+	}
+	wg.Wait()
+	return report, nil
+}
+
+// planSync compares the objects of src and dst and returns the actions needed to bring dst in line with src.
+func planSync(ctx context.Context, src, dst Backend, opts SyncOptions) (*SyncReport, error) {
+	srcObjects, err := src.List(ctx, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	dstObjects, err := dst.List(ctx, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]ObjectInfo, len(dstObjects))
+	for _, obj := range dstObjects {
+		existing[obj.Name] = obj
+	}
+	sources := make(map[string]bool, len(srcObjects))
+	for _, obj := range srcObjects {
+		sources[obj.Name] = true
+	}
+	// Archives are compared through their manifests only when both sides have one.
+	manifests := make(map[string]bool)
+	for _, obj := range srcObjects {
+		name := obj.Name + manifestExtension
+		if _, ok := existing[name]; ok && sources[name] {
+			manifests[name] = true
+		}
+	}
+
+	report := &SyncReport{
+		Source:      src.Location(opts.Prefix),
+		Destination: dst.Location(opts.Prefix),
+		DryRun:      opts.DryRun,
+		Actions:     []SyncAction{},
+	}
+	for _, obj := range srcObjects {
+		target, ok := existing[obj.Name]
+		delete(existing, obj.Name)
+
+		switch {
+		case !ok:
+			report.add(SyncCopy, obj, "missing from destination")
+		case target.Size != obj.Size:
+			report.add(SyncUpdate, obj, fmt.Sprintf("size differs: %d bytes, destination has %d", obj.Size, target.Size))
+		default:
+			reason, err := compareObject(ctx, src, dst, obj.Name, manifests[obj.Name+manifestExtension], opts.Checksum)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				report.add(SyncUpdate, obj, reason)
+			} else {
+				report.Unchanged++
+			}
+		}
+	}
+
+	if opts.Delete {
+		// Iterate in name order, as returned by List, for a stable plan.
+		for _, obj := range dstObjects {
+			if _, ok := existing[obj.Name]; ok {
+				report.add(SyncDelete, obj, "missing from source")
+			}
+		}
+	}
+	return report, nil
+}
+
+// add records the given operation on obj.
+func (r *SyncReport) add(op SyncOp, obj ObjectInfo, reason string) {
+	r.Actions = append(r.Actions, SyncAction{Op: op, Name: obj.Name, Size: obj.Size, Reason: reason})
+}
+
+// applySyncAction copies or deletes the object of the given action.
+func applySyncAction(ctx context.Context, src, dst Backend, a *SyncAction) error {
+	if a.Op == SyncDelete {
+		return dst.Delete(ctx, a.Name)
+	}
+
+	rc, err := src.Get(ctx, a.Name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return dst.Put(ctx, a.Name, rc)
+}
+
+// compareObject compares the named object, of the same size in src and dst, and returns why it differs, or an empty
+// string when both copies are considered identical. Archives whose manifest is in both backends are compared by the
+// digests the manifests record, and manifests, which are small, by their content. Other objects are compared by
+// their SHA-256 digest with checksum, or else considered identical.
+func compareObject(ctx context.Context, src, dst Backend, name string, manifest, checksum bool) (string, error) {
+	if manifest {
+		srcDigest, err := manifestDigest(ctx, src, name)
+		if err != nil {
+			return "", err
+		}
+		dstDigest, err := manifestDigest(ctx, dst, name)
+		if err != nil {
+			return "", err
+		}
+		if srcDigest != "" && dstDigest != "" {
+			if srcDigest != dstDigest {
+				return "manifest digest differs", nil
+			}
+			return "", nil
+		}
+	}
+	if !checksum && !strings.HasSuffix(name, manifestExtension) {
+		return "", nil
+	}
+
+	same, err := sameContent(ctx, src, dst, name)
+	if err != nil || same {
+		return "", err
+	}
+	return "SHA-256 digest differs", nil
+}
+
+// manifestDigest returns the archive digest recorded in the manifest of the named archive, or an empty string if the
+// manifest does not record one.
+func manifestDigest(ctx context.Context, b Backend, name string) (string, error) {
+	rc, err := b.Get(ctx, name+manifestExtension)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var m struct {
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.NewDecoder(contextReader{ctx: ctx, r: rc}).Decode(&m); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", b.Location(name+manifestExtension), err)
+	}
+	return m.SHA256, nil
+}
+
+// sameContent reports whether the named object has the same SHA-256 digest in both backends.
+func sameContent(ctx context.Context, src, dst Backend, name string) (bool, error) {
+	srcDigest, err := digest(ctx, src, name)
+	if err != nil {
+		return false, err
+	}
+	dstDigest, err := digest(ctx, dst, name)
+	if err != nil {
+		return false, err
+	}
+	return srcDigest == dstDigest, nil
+}
+
+// digest returns the hex-encoded SHA-256 digest of the named object.
+func digest(ctx context.Context, b Backend, name string) (string, error) {
+	rc, err := b.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, contextReader{ctx: ctx, r: rc}); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", b.Location(name), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,188 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/madalinpopa/aerovault/storage"
+)
+
+// newSyncBackends returns two local backends holding the given objects.
+func newSyncBackends(t *testing.T, src, dst map[string]string) (storage.Backend, storage.Backend) {
+	t.Helper()
+	backends := make([]storage.Backend, 2)
+	for i, objects := range []map[string]string{src, dst} {
+		b, err := storage.NewFileBackend(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range objects {
+			if err := b.Put(context.Background(), name, strings.NewReader(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		backends[i] = b
+	}
+	return backends[0], backends[1]
+}
+
+// readObject returns the content of the named object, or an empty string if it does not exist.
+func readObject(t *testing.T, b storage.Backend, name string) string {
+	t.Helper()
+	rc, err := b.Get(context.Background(), name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	return string(data)
+}
+
+// actionsOf returns the actions of the report as "op name" strings.
+func actionsOf(report *storage.SyncReport) []string {
+	var actions []string
+	for _, a := range report.Actions {
+		actions = append(actions, string(a.Op)+" "+a.Name)
+	}
+	return actions
+}
+
+// TestSync verifies that missing objects are copied, objects of another size replaced and others left untouched.
+func TestSync(t *testing.T) {
+	src, dst := newSyncBackends(t,
+		map[string]string{"data-1.tar": "one", "data-2.tar": "two", "db-1.tar": "db"},
+		map[string]string{"data-1.tar": "one", "data-2.tar": "2", "old-1.tar": "old"},
+	)
+
+	report, err := storage.Sync(context.Background(), src, dst, storage.SyncOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := strings.Join(actionsOf(report), ", "); got != "update data-2.tar, copy db-1.tar" {
+		t.Errorf("unexpected actions %q", got)
+	}
+	if report.Unchanged != 1 {
+		t.Errorf("expected 1 unchanged object, got %d", report.Unchanged)
+	}
+	if report.Err() != nil {
+		t.Errorf("expected no failures, got %s", report.Err())
+	}
+
+	for name, content := range map[string]string{"data-2.tar": "two", "db-1.tar": "db", "old-1.tar": "old"} {
+		if got := readObject(t, dst, name); got != content {
+			t.Errorf("expected %s to hold %q, got %q", name, content, got)
+		}
+	}
+}
+
+// TestSync_checksum verifies that objects of the same size without a manifest are compared by digest only with
+// Checksum.
+func TestSync_checksum(t *testing.T) {
+	src, dst := newSyncBackends(t, map[string]string{"data-1.tar": "one"}, map[string]string{"data-1.tar": "uno"})
+
+	report, err := storage.Sync(context.Background(), src, dst, storage.SyncOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if len(report.Actions) != 0 {
+		t.Errorf("expected same-size objects to be skipped without checksum, got %v", actionsOf(report))
+	}
+
+	report, err = storage.Sync(context.Background(), src, dst, storage.SyncOptions{Checksum: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := strings.Join(actionsOf(report), ", "); got != "update data-1.tar" {
+		t.Errorf("unexpected actions %q", got)
+	}
+	if got := readObject(t, dst, "data-1.tar"); got != "one" {
+		t.Errorf("expected data-1.tar to be replaced, got %q", got)
+	}
+}
+
+// TestSync_manifest verifies that archives of the same size are compared by the digests of their manifests, along
+// with the manifests themselves.
+func TestSync_manifest(t *testing.T) {
+	src, dst := newSyncBackends(t,
+		map[string]string{
+			"data-1.tar": "one", "data-1.tar.manifest.json": `{"sha256":"aaaa"}`,
+			"data-2.tar": "two", "data-2.tar.manifest.json": `{"sha256":"bbbb"}`,
+		},
+		map[string]string{
+			"data-1.tar": "uno", "data-1.tar.manifest.json": `{"sha256":"cccc"}`,
+			"data-2.tar": "TWO", "data-2.tar.manifest.json": `{"sha256":"bbbb"}`,
+		},
+	)
+
+	report, err := storage.Sync(context.Background(), src, dst, storage.SyncOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := strings.Join(actionsOf(report), ", "); got != "update data-1.tar, update data-1.tar.manifest.json" {
+		t.Errorf("unexpected actions %q", got)
+	}
+	if report.Unchanged != 2 {
+		t.Errorf("expected 2 unchanged objects, got %d", report.Unchanged)
+	}
+	if got := readObject(t, dst, "data-1.tar"); got != "one" {
+		t.Errorf("expected data-1.tar to be replaced, got %q", got)
+	}
+}
+
+// TestSync_manifestOnlyInDestination verifies that archives whose manifest exists only in the destination are compared
+// by content rather than by manifest.
+func TestSync_manifestOnlyInDestination(t *testing.T) {
+	src, dst := newSyncBackends(t,
+		map[string]string{"data-1.tar": "one"},
+		map[string]string{"data-1.tar": "uno", "data-1.tar.manifest.json": `{"sha256":"cccc"}`},
+	)
+
+	report, err := storage.Sync(context.Background(), src, dst, storage.SyncOptions{Checksum: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := strings.Join(actionsOf(report), ", "); got != "update data-1.tar" {
+		t.Errorf("unexpected actions %q", got)
+	}
+	if got := readObject(t, dst, "data-1.tar"); got != "one" {
+		t.Errorf("expected data-1.tar to be replaced, got %q", got)
+	}
+}
+
+// TestSync_deleteDryRun verifies that objects missing from the source are deleted within the prefix, and that a dry run
+// changes nothing.
+func TestSync_deleteDryRun(t *testing.T) {
+	src, dst := newSyncBackends(t,
+		map[string]string{"data-1.tar": "one"},
+		map[string]string{"data-0.tar": "zero", "other.tar": "other"},
+	)
+
+	opts := storage.SyncOptions{Prefix: "data-", Delete: true, DryRun: true}
+	report, err := storage.Sync(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got := strings.Join(actionsOf(report), ", "); got != "copy data-1.tar, delete data-0.tar" {
+		t.Errorf("unexpected actions %q", got)
+	}
+	if readObject(t, dst, "data-1.tar") != "" || readObject(t, dst, "data-0.tar") != "zero" {
+		t.Error("expected dry run to leave the destination untouched")
+	}
+
+	opts.DryRun = false
+	if _, err := storage.Sync(context.Background(), src, dst, opts); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if readObject(t, dst, "data-0.tar") != "" {
+		t.Error("expected data-0.tar to be deleted")
+	}
+	if readObject(t, dst, "other.tar") != "other" {
+		t.Error("expected objects outside the prefix to be kept")
+	}
+}